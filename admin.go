@@ -5,7 +5,12 @@ import (
 	"net/http"
 )
 
+// handlerReset wipes every user, so it's refused anywhere but development.
 func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
+	if cfg.platform != "dev" {
+		respondWithError(w, http.StatusForbidden, "Reset is only allowed in the dev environment")
+		return
+	} 
 	cfg.fileserverHits.Store(0)
 	if err := cfg.dbQueries.ResetUsers(r.Context()); err != nil {
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Erorr reseting users: %v", err))
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/auth"
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// apiKeyPrefix marks Chirpy keys, so leaked ones are easy to spot.
+	apiKeyPrefix = "chirpy_"
+	// apiKeyShownLength is how much of a key is kept to tell it apart.
+	apiKeyShownLength = len(apiKeyPrefix) + 6
+	maxAPIKeyNameLength = 100
+)
+
+// APIKey is a personal API key. The key itself is only ever returned when
+// it's created.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        string     `json:"key,omitempty"`
+} 
+
+func apiKeyFromDB(k database.ApiKey) APIKey {
+	key := APIKey{
+		ID: k.ID,
+		Name: k.Name,
+		Prefix: k.Prefix,
+		Scopes: k.Scopes,
+		CreatedAt: k.CreatedAt,
+	} 
+	if k.LastUsedAt.Valid {
+		key.LastUsedAt = &k.LastUsedAt.Time
+	} 
+	return key
+} 
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+} 
+
+// validateAPIKeyRequest checks the name and scopes of a new key, which must
+// be among those the user is allowed, returning the scopes without
+// duplicates.
+func validateAPIKeyRequest(params createAPIKeyRequest, allowed []string) ([]string, error) {
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		return nil, fmt.Errorf("Name must be 1-%d characters", maxAPIKeyNameLength)
+	} 
+	if len(params.Scopes) == 0 {
+		return nil, errors.New("At least one scope is required")
+	} 
+	var scopes []string
+	for _, scope := range params.Scopes {
+		if !slices.Contains(allScopes, scope) {
+			return nil, fmt.Errorf("Unknown scope %q", scope)
+		} 
+		if !slices.Contains(allowed, scope) {
+			return nil, fmt.Errorf("Scope %q needs a verified email address", scope)
+		} 
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		} 
+	} 
+	return scopes, nil
+} 
+
+// handlerCreateAPIKey makes a key for the user. Keys can only be managed
+// from a logged in session, not with another key.
+func (cfg *apiConfig) handlerCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+	params, err := decodeJSON[createAPIKeyRequest](r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
+		return
+	} 
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving user: %v", err))
+		return
+	} 
+	scopes, err := validateAPIKeyRequest(params, cfg.scopesFor(user.EmailVerifiedAt.Valid))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	} 
+
+	secret := apiKeyPrefix + auth.MakeRefreshToken()
+	created, err := cfg.dbQueries.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID: userID,
+		Name: strings.TrimSpace(params.Name),
+		KeyHash: auth.HashToken(secret),
+		Prefix: secret[:apiKeyShownLength],
+		Scopes: scopes,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error creating API key: %v", err))
+		return
+	} 
+	key := apiKeyFromDB(created)
+	key.Key = secret
+	respondWithJSON(w, http.StatusCreated, key)
+} 
+
+func (cfg *apiConfig) handlerGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+
+	dbKeys, err := cfg.dbQueries.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving API keys: %v", err))
+		return
+	} 
+	keys := make([]APIKey, len(dbKeys))
+	for i, k := range dbKeys {
+		keys[i] = apiKeyFromDB(k)
+	} 
+	respondWithJSON(w, http.StatusOK, keys)
+} 
+
+func (cfg *apiConfig) handlerRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := uuid.Parse(r.PathValue("keyID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprint(err))
+		return
+	} 
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+
+	deleted, err := cfg.dbQueries.DeleteAPIKey(r.Context(), database.DeleteAPIKeyParams{
+		ID: keyID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error revoking API key: %v", err))
+		return
+	} 
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "API key not found")
+		return
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/JoStMc/Chirpy/internal/media"
+	"github.com/google/uuid"
+)
+
+const (
+	maxAttachmentSize = 5 << 20
+	// maxFormMemory is how much of a multipart form is held in memory. The
+	// rest of the images are spooled to temporary files.
+	maxFormMemory = 1 << 20
+)
+
+type Attachment struct {
+	URL             string `json:"url"`
+	ContentType     string `json:"content_type"`
+	Width           int32  `json:"width"`
+	Height          int32  `json:"height"`
+	ThumbnailURL    string `json:"thumbnail_url"`
+	ThumbnailWidth  int32  `json:"thumbnail_width"`
+	ThumbnailHeight int32  `json:"thumbnail_height"`
+} 
+
+// decodeCreateChirpRequest accepts either the original JSON body or a
+// multipart form with "body", "user_id", "in_reply_to", "quote_of",
+// "publish_at" and "images". The user isn't known yet, so the form may be as
+// large as the most generous plan allows. The caller must remove the form's
+// temporary files.
+func (cfg *apiConfig) decodeCreateChirpRequest(w http.ResponseWriter, r *http.Request) (createChirpRequests, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return decodeJSON[createChirpRequests](r)
+	} 
+
+	// Leave room for the text fields and multipart framing on top of the
+	// images themselves.
+	maxFormSize := int64(cfg.entitlements.Max().MaxAttachments)*maxAttachmentSize + 1<<20
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+	if err := r.ParseMultipartForm(maxFormMemory); err != nil {
+		return createChirpRequests{}, err
+	} 
+
+	params := createChirpRequests{
+		Body: r.FormValue("body"),
+		Images: r.MultipartForm.File["images"],
+	} 
+	userID, err := uuid.Parse(r.FormValue("user_id"))
+	if err != nil {
+		return createChirpRequests{}, errors.New("invalid user_id")
+	} 
+	params.UserID = userID
+	if inReplyTo := r.FormValue("in_reply_to"); inReplyTo != "" {
+		parentID, err := uuid.Parse(inReplyTo)
+		if err != nil {
+			return createChirpRequests{}, errors.New("invalid in_reply_to")
+		} 
+		params.InReplyTo = &parentID
+	} 
+	if quoteOf := r.FormValue("quote_of"); quoteOf != "" {
+		quotedID, err := uuid.Parse(quoteOf)
+		if err != nil {
+			return createChirpRequests{}, errors.New("invalid quote_of")
+		} 
+		params.QuoteOf = &quotedID
+	} 
+	if publishAt := r.FormValue("publish_at"); publishAt != "" {
+		t, err := time.Parse(time.RFC3339, publishAt)
+		if err != nil {
+			return createChirpRequests{}, errors.New("invalid publish_at")
+		} 
+		params.PublishAt = &t
+	} 
+	return params, nil
+} 
+
+// processedAttachment is an upload that has been validated, cleaned and
+// written to the blob store, but not yet recorded against a chirp.
+type processedAttachment struct {
+	full     media.Image
+	thumb    media.Image
+	blobKey  string
+	thumbKey string
+} 
+
+// storeAttachments processes the uploaded images and writes them to the blob
+// store. If any image fails, the ones already stored are removed again.
+func (cfg *apiConfig) storeAttachments(ctx context.Context, files []*multipart.FileHeader) ([]processedAttachment, error) {
+	stored := make([]processedAttachment, 0, len(files))
+	for _, fh := range files {
+		a, err := cfg.storeAttachment(ctx, fh)
+		if err != nil {
+			cfg.deleteProcessedAttachments(ctx, stored)
+			return nil, err
+		} 
+		stored = append(stored, a)
+	} 
+	return stored, nil
+} 
+
+func (cfg *apiConfig) storeAttachment(ctx context.Context, fh *multipart.FileHeader) (processedAttachment, error) {
+	if fh.Size > maxAttachmentSize {
+		return processedAttachment{}, fmt.Errorf("%s is larger than %d MB", fh.Filename, maxAttachmentSize>>20)
+	} 
+	f, err := fh.Open()
+	if err != nil {
+		return processedAttachment{}, err
+	} 
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxAttachmentSize+1))
+	if err != nil {
+		return processedAttachment{}, err
+	} 
+	if len(data) > maxAttachmentSize {
+		return processedAttachment{}, fmt.Errorf("%s is larger than %d MB", fh.Filename, maxAttachmentSize>>20)
+	} 
+
+	full, thumb, err := media.Process(data)
+	if err != nil {
+		return processedAttachment{}, fmt.Errorf("%s: %w", fh.Filename, err)
+	} 
+
+	id := uuid.New()
+	a := processedAttachment{
+		full: full,
+		thumb: thumb,
+		blobKey: "chirps/" + id.String() + full.Extension,
+		thumbKey: "chirps/" + id.String() + "_thumb" + thumb.Extension,
+	} 
+	if err := cfg.blobStore.Put(ctx, a.blobKey, full.ContentType, bytes.NewReader(full.Data)); err != nil {
+		return processedAttachment{}, fmt.Errorf("storing image: %w", err)
+	} 
+	if err := cfg.blobStore.Put(ctx, a.thumbKey, thumb.ContentType, bytes.NewReader(thumb.Data)); err != nil {
+		cfg.deleteBlobs(ctx, a.blobKey)
+		return processedAttachment{}, fmt.Errorf("storing thumbnail: %w", err)
+	} 
+	return a, nil
+} 
+
+func (cfg *apiConfig) deleteProcessedAttachments(ctx context.Context, attachments []processedAttachment) {
+	for _, a := range attachments {
+		cfg.deleteBlobs(ctx, a.blobKey, a.thumbKey)
+	} 
+} 
+
+func (cfg *apiConfig) deleteAttachmentBlobs(ctx context.Context, attachments []database.ChirpAttachment) {
+	for _, a := range attachments {
+		cfg.deleteBlobs(ctx, a.BlobKey, a.ThumbKey)
+	} 
+} 
+
+// deleteBlobs is best effort: the rows pointing at the blobs are already
+// gone, so a failure only leaves an orphaned file behind.
+func (cfg *apiConfig) deleteBlobs(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := cfg.blobStore.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting blob %s: %v", key, err)
+		} 
+	} 
+} 
+
+// setAttachments loads the attachments of each chirp.
+func (cfg *apiConfig) setAttachments(ctx context.Context, chirps []Chirp) error {
+	ids := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		ids[i] = c.ID
+	} 
+	attachments, err := cfg.dbQueries.GetChirpAttachments(ctx, ids)
+	if err != nil {
+		return err
+	} 
+
+	byChirp := make(map[uuid.UUID][]Attachment)
+	for _, a := range attachments {
+		byChirp[a.ChirpID] = append(byChirp[a.ChirpID], cfg.attachmentFromDB(a))
+	} 
+	for i := range chirps {
+		chirps[i].Attachments = byChirp[chirps[i].ID]
+	} 
+	return nil
+} 
+
+func (cfg *apiConfig) attachmentFromDB(a database.ChirpAttachment) Attachment {
+	return Attachment{
+		URL: cfg.blobStore.URL(a.BlobKey),
+		ContentType: a.ContentType,
+		Width: a.Width,
+		Height: a.Height,
+		ThumbnailURL: cfg.blobStore.URL(a.ThumbKey),
+		ThumbnailWidth: a.ThumbWidth,
+		ThumbnailHeight: a.ThumbHeight,
+	} 
+} 
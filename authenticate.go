@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/JoStMc/Chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+const (
+	scopeChirpsRead   = "chirps:read"
+	scopeChirpsWrite  = "chirps:write"
+	scopeProfileWrite = "profile:write"
+)
+
+// allScopes are granted to the access tokens users get by logging in.
+var allScopes = []string{scopeChirpsRead, scopeChirpsWrite, scopeProfileWrite}
+
+var errInsufficientScope = errors.New("missing required scope")
+
+// principal is who a request was made by, and what they're allowed to do.
+type principal struct {
+	UserID uuid.UUID
+	// SessionID is the login session of an access token. API keys have none.
+	SessionID uuid.UUID
+	Scopes []string
+	APIKey bool
+} 
+
+func (p principal) hasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+} 
+
+// authenticate identifies the caller from either an access token, as
+// "Authorization: Bearer <token>", or a personal API key, as
+// "Authorization: ApiKey <key>".
+func (cfg *apiConfig) authenticate(r *http.Request) (principal, error) {
+	if key, err := auth.GetAPIKey(r.Header); err == nil {
+		apiKey, err := cfg.dbQueries.UseAPIKey(r.Context(), auth.HashToken(key))
+		if err != nil {
+			return principal{}, errors.New("invalid API key")
+		} 
+		return principal{UserID: apiKey.UserID, Scopes: apiKey.Scopes, APIKey: true}, nil
+	} 
+
+	claims, err := cfg.authenticatedClaims(r)
+	if err != nil {
+		return principal{}, err
+	} 
+	userID, err := claims.UserID()
+	if err != nil {
+		return principal{}, fmt.Errorf("invalid token: %w", err)
+	} 
+	return principal{UserID: userID, SessionID: claims.Session(), Scopes: claims.Scopes()}, nil
+} 
+
+// scopedUserID returns the ID of the caller, by access token or API key, if
+// their credentials grant scope.
+func (cfg *apiConfig) scopedUserID(r *http.Request, scope string) (uuid.UUID, error) {
+	p, err := cfg.authenticate(r)
+	if err != nil {
+		return uuid.Nil, err
+	} 
+	if !p.hasScope(scope) {
+		return uuid.Nil, fmt.Errorf("%w %s", errInsufficientScope, scope)
+	} 
+	return p.UserID, nil
+} 
+
+// authErrorStatus is the status to respond with when authentication fails:
+// 403 if the caller is known but lacks a scope, or else 401.
+func authErrorStatus(err error) int {
+	if errors.Is(err, errInsufficientScope) {
+		return http.StatusForbidden
+	} 
+	return http.StatusUnauthorized
+} 
+
+// authenticatedUserID returns the ID of the user bearing a valid access token
+// in the Authorization header. It's for endpoints that API keys can't use.
+func (cfg *apiConfig) authenticatedUserID(r *http.Request) (uuid.UUID, error) {
+	claims, err := cfg.authenticatedClaims(r)
+	if err != nil {
+		return uuid.Nil, err
+	} 
+	userID, err := claims.UserID()
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid token: %w", err)
+	} 
+	return userID, nil
+} 
+
+// authenticatedClaims returns the claims of a valid access token in the
+// Authorization header, for handlers that need more than the user ID.
+func (cfg *apiConfig) authenticatedClaims(r *http.Request) (*auth.CustomClaims, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return nil, err
+	} 
+	claims, err := auth.ParseJWT(token, cfg.jwtKeys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	} 
+	return claims, nil
+} 
+
+// optionalUserID is for public endpoints that show extra detail to signed-in
+// users. Missing or invalid credentials just mean an anonymous viewer.
+func (cfg *apiConfig) optionalUserID(r *http.Request) uuid.NullUUID {
+	userID, err := cfg.scopedUserID(r, scopeChirpsRead)
+	if err != nil {
+		return uuid.NullUUID{}
+	} 
+	return uuid.NullUUID{UUID: userID, Valid: true}
+} 
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type chirpRevision struct {
+	ID         uuid.UUID `json:"id"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+} 
+
+func (cfg *apiConfig) handlerGetChirpHistory(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprint(err))
+		return
+	} 
+
+	ctx := r.Context()
+	if _, err := cfg.dbQueries.GetChirp(ctx, chirpID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "chirp not found")
+			return
+		} 
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving chirp: %v", err))
+		return
+	} 
+
+	revisions, err := cfg.dbQueries.GetChirpRevisions(ctx, chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving history: %v", err))
+		return
+	} 
+
+	response := make([]chirpRevision, len(revisions))
+	for i, rev := range revisions {
+		response[i] = chirpRevision{
+			ID:         rev.ID,
+			Body:       rev.Body,
+			CreatedAt:  rev.CreatedAt,
+			ReplacedAt: rev.ReplacedAt,
+		} 
+	} 
+	respondWithJSON(w, http.StatusOK, response)
+} 
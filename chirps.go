@@ -1,94 +1,390 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"mime/multipart"
 	"net/http"
-	"slices"
 	"strings"
 	"time"
 
-	"github.com/JoStMc/Chirpy/internal/auth"
 	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/JoStMc/Chirpy/internal/media"
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Body       string     `json:"body"`
+	UserID     uuid.UUID  `json:"user_id"`
+	InReplyTo  *uuid.UUID `json:"in_reply_to"`
+	ReplyCount int32      `json:"reply_count"`
+	LikeCount  int32      `json:"like_count"`
+	LikedByMe  *bool      `json:"liked_by_me,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Mentions   []uuid.UUID `json:"mentions,omitempty"`
+	Deleted    bool       `json:"deleted,omitempty"`
+	RechirpOf  *uuid.UUID `json:"rechirp_of"`
+	QuoteOf    *uuid.UUID `json:"quote_of"`
+	RechirpCount int32    `json:"rechirp_count"`
+	// Original is the rechirped or quoted chirp, which may be a tombstone.
+	Original   *Chirp     `json:"original,omitempty"`
+} 
+
+// chirpFromDB converts a stored chirp to its API form. A deleted chirp that
+// still has replies is kept as a tombstone so its thread stays intact.
+func chirpFromDB(c database.Chirp) Chirp {
+	chirp := Chirp{
+		ID: c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body: c.Body,
+		UserID: c.UserID,
+		ReplyCount: c.ReplyCount,
+		LikeCount: c.LikeCount,
+		Deleted: c.DeletedAt.Valid,
+		RechirpCount: c.RechirpCount,
+	} 
+	if c.ParentID.Valid {
+		chirp.InReplyTo = &c.ParentID.UUID
+	} 
+	if c.RechirpOf.Valid {
+		chirp.RechirpOf = &c.RechirpOf.UUID
+	} 
+	if c.QuoteOf.Valid {
+		chirp.QuoteOf = &c.QuoteOf.UUID
+	} 
+	return chirp
+} 
+
+// populateChirps fills in the parts of each chirp that don't come from its
+// own row, such as whether the viewer has liked it and the chirp it rechirps
+// or quotes.
+func (cfg *apiConfig) populateChirps(r *http.Request, chirps []Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	} 
+	if err := cfg.setOriginals(r, chirps); err != nil {
+		return err
+	} 
+	return cfg.setChirpDetails(r, chirps)
+} 
+
+// setChirpDetails is populateChirps without the embedded originals.
+func (cfg *apiConfig) setChirpDetails(r *http.Request, chirps []Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	} 
+	if err := cfg.setAttachments(r.Context(), chirps); err != nil {
+		return err
+	} 
+	if err := cfg.setMentions(r.Context(), chirps); err != nil {
+		return err
+	} 
+	if viewer := cfg.optionalUserID(r); viewer.Valid {
+		if err := cfg.setLikedByMe(r.Context(), viewer.UUID, chirps); err != nil {
+			return err
+		} 
+	} 
+	return nil
+} 
+
+// parseAuthorID reads the optional author_id filter shared by the chirp
+// listing endpoints. It takes either a user ID or a handle.
+func (cfg *apiConfig) parseAuthorID(r *http.Request) (uuid.NullUUID, error) {
+	author := r.URL.Query().Get("author_id")
+	if author == "" {
+		return uuid.NullUUID{}, nil
+	} 
+	if id, err := uuid.Parse(author); err == nil {
+		return uuid.NullUUID{UUID: id, Valid: true}, nil
+	} 
+	if !handlePattern.MatchString(author) {
+		return uuid.NullUUID{}, errInvalidAuthorID
+	} 
+	user, err := cfg.lookupUser(r, author)
+	if err != nil {
+		return uuid.NullUUID{}, err
+	} 
+	return uuid.NullUUID{UUID: user.ID, Valid: true}, nil
+} 
+
+var errInvalidAuthorID = errors.New("author_id must be a user ID or handle")
+
+// respondWithAuthorError reports a failed parseAuthorID.
+func respondWithAuthorError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errInvalidAuthorID) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	} 
+	if errors.Is(err, errUserNotFound) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	} 
+	respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving user: %v", err))
 } 
 
 type createChirpRequests struct {
 	Body string `json:"body"`
 	UserID uuid.UUID `json:"user_id"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	QuoteOf *uuid.UUID `json:"quote_of"`
+	PublishAt *time.Time `json:"publish_at"`
+	Images []*multipart.FileHeader `json:"-"`
 }
 
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request) {
-	params, err := decodeJSON[createChirpRequests](r)
+	// Authenticate before reading the body, so only users can make us parse
+	// an upload.
+	bearerID, err := cfg.scopedUserID(r, scopeChirpsWrite)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error decoding parameters: %v", err))
+		respondWithError(w, authErrorStatus(err), fmt.Sprintf("Access denied: %v", err))
 		return
 	} 
-
-	if len(params.Body) > 140 {
-		respondWithJSON(w, http.StatusBadRequest, struct{Err string `json:"error"`}{Err: "Chirp is too long"})
+	params, err := cfg.decodeCreateChirpRequest(w, r)
+	if r.MultipartForm != nil {
+		// Clean up any images that were spooled to disk.
+		defer r.MultipartForm.RemoveAll()
+	} 
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
 		return
 	} 
-	if len(params.Body) < 1 {
-		respondWithError(w, http.StatusBadRequest,	"Chirp must be at least 1 character")
+	if bearerID != params.UserID {
+		respondWithError(w, http.StatusUnauthorized, "Access denied")
 		return
 	} 
-	params.Body = replaceBadWords(params.Body)
 
-	bearerToken, err := auth.GetBearerToken(r.Header)
+	ctx := r.Context()
+	limits, err := cfg.entitlements.Limits(ctx, bearerID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking plan: %v", err))
 		return
 	} 
-	bearerID, err := auth.ValidateJWT(bearerToken, cfg.jwtSecret)
+	if len(params.Images) > limits.MaxAttachments {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("A chirp can have at most %d images", limits.MaxAttachments))
+		return
+	} 
+	params.Body, err = validateChirpBody(params.Body, limits.MaxChirpLength)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Access denied: %v", err))
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	} 
-	if bearerID != params.UserID {
-		respondWithError(w, http.StatusUnauthorized, "Access denied")
+	if !cfg.allowChirp(w, bearerID, limits) {
+		return
+	} 
+	if params.PublishAt != nil {
+		cfg.scheduleChirp(w, r, params, limits)
+		return
+	} 
+
+	nc := newChirp{
+		CreateChirpParams: database.CreateChirpParams{
+			Body: params.Body,
+			UserID: params.UserID,
+		},
+		tags: extractHashtags(params.Body),
+	} 
+	if params.InReplyTo != nil {
+		parent, err := cfg.getOriginalChirp(ctx, *params.InReplyTo)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "Chirp being replied to not found")
+			return
+		} 
+		nc.ParentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+		nc.parentAuthorID = parent.UserID
+	} 
+	if params.QuoteOf != nil {
+		quoted, err := cfg.getOriginalChirp(ctx, *params.QuoteOf)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "Chirp being quoted not found")
+			return
+		} 
+		nc.QuoteOf = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+		nc.originalAuthorID = quoted.UserID
+	} 
+
+	nc.mentions, err = cfg.resolveMentions(ctx, params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error resolving mentions: %v", err))
 		return
 	} 
 
-	chirp, err := cfg.dbQueries.CreateChirp(r.Context(), database.CreateChirpParams(params))
+	nc.images, err = cfg.storeAttachments(ctx, params.Images)
 	if err != nil {
+		if errors.Is(err, media.ErrUnsupportedType) {
+			respondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+			return
+		} 
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid image: %v", err))
+		return
+	} 
+
+	chirp, attachments, err := cfg.createChirp(ctx, nc)
+	if err != nil {
+		cfg.deleteProcessedAttachments(ctx, nc.images)
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error creating chirp: %v", err))
 		return
 	} 
 
-	respondWithJSON(w, http.StatusCreated, Chirp(chirp))
+	apiChirps := []Chirp{chirpFromDB(chirp)}
+	if err := cfg.setOriginals(r, apiChirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving quoted chirp: %v", err))
+		return
+	} 
+	for _, a := range attachments {
+		apiChirps[0].Attachments = append(apiChirps[0].Attachments, cfg.attachmentFromDB(a))
+	} 
+	apiChirps[0].Mentions = nc.mentions
+	respondWithJSON(w, http.StatusCreated, apiChirps[0])
 }
 
-func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request) {
-	authorIdString := r.URL.Query().Get("author_id")
-	fmt.Printf("rawquery=%q author_id=%q\n", r.URL.RawQuery, authorIdString)
-	_, err := uuid.Parse(authorIdString)
-	if authorIdString != "" && err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid user id")
-		return
+// newChirp is everything that gets written when a chirp is posted.
+type newChirp struct {
+	database.CreateChirpParams
+	parentAuthorID uuid.UUID
+	// originalAuthorID is the author of the chirp being rechirped or quoted.
+	originalAuthorID uuid.UUID
+	tags           []string
+	mentions       []uuid.UUID
+	images         []processedAttachment
+} 
+
+// createChirp inserts a chirp together with its hashtags, mentions and already
+// stored images, and notifies the users it mentions, replies to, rechirps or
+// quotes.
+func (cfg *apiConfig) createChirp(ctx context.Context, nc newChirp) (database.Chirp, []database.ChirpAttachment, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Chirp{}, nil, err
 	} 
+	defer tx.Rollback()
 
+	chirp, attachments, err := insertChirp(ctx, cfg.dbQueries.WithTx(tx), nc)
+	if err != nil {
+		return database.Chirp{}, nil, err
+	} 
+	return chirp, attachments, tx.Commit()
+} 
 
+// insertChirp does the writes for createChirp inside the caller's transaction.
+func insertChirp(ctx context.Context, qtx *database.Queries, nc newChirp) (database.Chirp, []database.ChirpAttachment, error) {
+	chirp, err := qtx.CreateChirp(ctx, nc.CreateChirpParams)
+	if err != nil {
+		return database.Chirp{}, nil, err
+	} 
+	chirpID := uuid.NullUUID{UUID: chirp.ID, Valid: true}
 
-	chirps, err := cfg.dbQueries.GetAllChirps(r.Context(), authorIdString)
+	if len(nc.tags) > 0 {
+		err = qtx.CreateChirpTags(ctx, database.CreateChirpTagsParams{
+			ChirpID: chirp.ID,
+			Tags: nc.tags,
+			CreatedAt: chirp.CreatedAt,
+		})
+		if err != nil {
+			return database.Chirp{}, nil, err
+		} 
+	} 
+
+	if len(nc.mentions) > 0 {
+		err = qtx.CreateChirpMentions(ctx, database.CreateChirpMentionsParams{
+			ChirpID: chirp.ID,
+			UserIds: nc.mentions,
+		})
+		if err != nil {
+			return database.Chirp{}, nil, err
+		} 
+	} 
+	for _, userID := range nc.mentions {
+		if err := notify(ctx, qtx, userID, chirp.UserID, notificationMention, chirpID); err != nil {
+			return database.Chirp{}, nil, err
+		} 
+	} 
+	if nc.ParentID.Valid {
+		if err := notify(ctx, qtx, nc.parentAuthorID, chirp.UserID, notificationReply, chirpID); err != nil {
+			return database.Chirp{}, nil, err
+		} 
+	} 
+	if nc.RechirpOf.Valid {
+		if err := notify(ctx, qtx, nc.originalAuthorID, chirp.UserID, notificationRechirp, chirpID); err != nil {
+			return database.Chirp{}, nil, err
+		} 
+	} 
+	if nc.QuoteOf.Valid {
+		if err := notify(ctx, qtx, nc.originalAuthorID, chirp.UserID, notificationQuote, chirpID); err != nil {
+			return database.Chirp{}, nil, err
+		} 
+	} 
+
+	attachments := make([]database.ChirpAttachment, len(nc.images))
+	for i, img := range nc.images {
+		attachments[i], err = qtx.CreateChirpAttachment(ctx, database.CreateChirpAttachmentParams{
+			ChirpID: chirp.ID,
+			Position: int32(i),
+			ContentType: img.full.ContentType,
+			BlobKey: img.blobKey,
+			Width: int32(img.full.Width),
+			Height: int32(img.full.Height),
+			ThumbKey: img.thumbKey,
+			ThumbWidth: int32(img.thumb.Width),
+			ThumbHeight: int32(img.thumb.Height),
+		})
+		if err != nil {
+			return database.Chirp{}, nil, err
+		} 
+	} 
+	return chirp, attachments, nil
+}
+
+func (cfg *apiConfig) handlerGetAllChirps(w http.ResponseWriter, r *http.Request) {
+	authorID, err := cfg.parseAuthorID(r)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving chirps: %v", err))
+		respondWithAuthorError(w, err)
 		return
 	} 
 
-	apiChirps := make([]Chirp, len(chirps))
-	for i, c := range chirps {
-		apiChirps[i] = Chirp(c)
+	p, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	} 
 
+	var chirps []database.Chirp
 	if r.URL.Query().Get("sort") == "desc" {
-		slices.Reverse(apiChirps)
+		chirps, err = cfg.dbQueries.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			AuthorID: authorID,
+			AfterCreatedAt: p.afterCreatedAt(),
+			AfterID: p.afterID(),
+			Limit: p.queryLimit(),
+		})
+	} else {
+		chirps, err = cfg.dbQueries.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			AuthorID: authorID,
+			AfterCreatedAt: p.afterCreatedAt(),
+			AfterID: p.afterID(),
+			Limit: p.queryLimit(),
+		})
+	} 
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving chirps: %v", err))
+		return
+	} 
+
+	n := setNextLink(w, r, p, len(chirps), func(i int) cursor {
+		return cursor{CreatedAt: chirps[i].CreatedAt, ID: chirps[i].ID}
+	})
+	apiChirps := make([]Chirp, n)
+	for i, c := range chirps[:n] {
+		apiChirps[i] = chirpFromDB(c)
+	} 
+	if err := cfg.populateChirps(r, apiChirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving chirps: %v", err))
+		return
 	} 
 
 	respondWithJSON(w, http.StatusOK, apiChirps)
@@ -107,10 +403,141 @@ func (cfg *apiConfig) handlerGetChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	} 
 
-	apiChirp := Chirp(chirp)
-	respondWithJSON(w, http.StatusOK, apiChirp)
+	apiChirps := []Chirp{chirpFromDB(chirp)}
+	if err := cfg.populateChirps(r, apiChirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving chirps: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, apiChirps[0])
 }
 
+type updateChirpRequest struct {
+	Body string `json:"body"`
+} 
+
+func (cfg *apiConfig) handlerUpdateChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprint(err))
+		return
+	} 
+	userID, err := cfg.scopedUserID(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithError(w, authErrorStatus(err), fmt.Sprint(err))
+		return
+	} 
+
+	params, err := decodeJSON[updateChirpRequest](r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
+		return
+	} 
+
+	ctx := r.Context()
+	limits, err := cfg.entitlements.Limits(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking plan: %v", err))
+		return
+	} 
+	body, err := validateChirpBody(params.Body, limits.MaxChirpLength)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	} 
+
+	mentions, err := cfg.resolveMentions(ctx, body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error resolving mentions: %v", err))
+		return
+	} 
+
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error starting transaction: %v", err))
+		return
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	chirp, err := qtx.GetChirpForUpdate(ctx, chirpID)
+	if err != nil || chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	} 
+	if chirp.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "cannot edit chirp")
+		return
+	} 
+	if chirp.RechirpOf.Valid {
+		respondWithError(w, http.StatusBadRequest, "Rechirps can't be edited")
+		return
+	} 
+	if time.Since(chirp.CreatedAt) > limits.EditWindow {
+		respondWithError(w, http.StatusForbidden, "Edit window has passed")
+		return
+	} 
+
+	if chirp.Body != body {
+		_, err = qtx.CreateChirpRevision(ctx, database.CreateChirpRevisionParams{
+			ChirpID: chirp.ID,
+			Body: chirp.Body,
+			CreatedAt: chirp.UpdatedAt,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error saving revision: %v", err))
+			return
+		} 
+		chirp, err = qtx.UpdateChirpBody(ctx, database.UpdateChirpBodyParams{
+			ID: chirp.ID,
+			Body: body,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error updating chirp: %v", err))
+			return
+		} 
+		if err := qtx.DeleteChirpTags(ctx, chirp.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error updating tags: %v", err))
+			return
+		} 
+		err = qtx.CreateChirpTags(ctx, database.CreateChirpTagsParams{
+			ChirpID: chirp.ID,
+			Tags: extractHashtags(body),
+			CreatedAt: chirp.CreatedAt,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error updating tags: %v", err))
+			return
+		} 
+		if err := replaceMentions(ctx, qtx, chirp, mentions); err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error updating mentions: %v", err))
+			return
+		} 
+	} 
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error updating chirp: %v", err))
+		return
+	} 
+	apiChirps := []Chirp{chirpFromDB(chirp)}
+	if err := cfg.populateChirps(r, apiChirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving chirp: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, apiChirps[0])
+} 
+
+// validateChirpBody checks a chirp's length against the author's plan and
+// censors it, returning the body that should be stored.
+func validateChirpBody(body string, maxLength int) (string, error) {
+	if len(body) > maxLength {
+		return "", errors.New("Chirp is too long")
+	} 
+	if len(body) < 1 {
+		return "", errors.New("Chirp must be at least 1 character")
+	} 
+	return replaceBadWords(body), nil
+} 
+
 var badWords = map[string]struct{}{
 	"kerfuffle": {},
 	"sharbert": {},
@@ -135,31 +562,160 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	} 
 	chirp, err := cfg.dbQueries.GetChirp(r.Context(), chirpId)
-	if err != nil {
+	if err != nil || chirp.DeletedAt.Valid {
 		respondWithError(w, http.StatusNotFound, "chirp not found")
 		return
 	} 
-	token, err := auth.GetBearerToken(r.Header)
+	caller, err := cfg.authenticate(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Error getting user token: %v", err))
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
 		return
 	} 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid token")
+	if !caller.hasScope(scopeChirpsWrite) {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("%v %s", errInsufficientScope, scopeChirpsWrite))
 		return
 	} 
 
-	if chirp.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "cannot delete chirp")
-		return
+	if chirp.UserID != caller.UserID {
+		// Moderators can delete anyone's chirps, but only when logged in,
+		// not with an API key.
+		role, err := cfg.userRole(r.Context(), caller.UserID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving user: %v", err))
+			return
+		} 
+		if caller.APIKey || !role.atLeast(roleModerator) {
+			respondWithError(w, http.StatusForbidden, "cannot delete chirp")
+			return
+		} 
 	} 
 
-	err = cfg.dbQueries.DeleteChirp(r.Context(), chirpId)
+	attachments, err := cfg.removeChirp(r.Context(), chirpId)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error deleting chirp: %v", err))
 		return
 	} 
+	cfg.deleteAttachmentBlobs(r.Context(), attachments)
+	if chirp.UserID != caller.UserID {
+		log.Printf("Moderator %s deleted chirp %s of user %s", caller.UserID, chirp.ID, chirp.UserID)
+	} 
 
 	w.WriteHeader(http.StatusNoContent)
 } 
+
+// removeChirp deletes a chirp, or leaves a tombstone if any reply, rechirp
+// or quote points at it, and returns the attachments whose blobs should now
+// be cleaned up. The chirp is locked while deciding, so a reply can't be
+// added in between.
+func (cfg *apiConfig) removeChirp(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpAttachment, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	chirp, err := qtx.GetChirpForUpdate(ctx, chirpID)
+	if err != nil {
+		return nil, err
+	} 
+	referenced, err := isChirpReferenced(ctx, qtx, chirp)
+	if err != nil {
+		return nil, err
+	} 
+
+	var attachments []database.ChirpAttachment
+	if referenced {
+		attachments, err = tombstoneChirp(ctx, qtx, chirpID)
+		if err != nil {
+			return nil, err
+		} 
+	} else {
+		attachments, err = qtx.DeleteChirpAttachments(ctx, chirpID)
+		if err != nil {
+			return nil, err
+		} 
+		if err := qtx.DeleteChirp(ctx, chirpID); err != nil {
+			return nil, err
+		} 
+		if err := deleteUnreferencedTombstones(ctx, qtx, referencedChirps(chirp)...); err != nil {
+			return nil, err
+		} 
+	} 
+	return attachments, tx.Commit()
+} 
+
+// isChirpReferenced reports whether any reply, rechirp or quote points at the
+// chirp, in which case deleting it leaves a tombstone.
+func isChirpReferenced(ctx context.Context, qtx *database.Queries, chirp database.Chirp) (bool, error) {
+	if chirp.ReplyCount > 0 || chirp.RechirpCount > 0 {
+		return true, nil
+	} 
+	return qtx.IsChirpQuoted(ctx, uuid.NullUUID{UUID: chirp.ID, Valid: true})
+} 
+
+// tombstoneChirp blanks a chirp and drops its edit history, tags, mentions
+// and attachments, keeping the row so replies still have a parent.
+func tombstoneChirp(ctx context.Context, qtx *database.Queries, chirpID uuid.UUID) ([]database.ChirpAttachment, error) {
+	if err := qtx.DeleteChirpRevisions(ctx, chirpID); err != nil {
+		return nil, err
+	} 
+	if err := qtx.DeleteChirpTags(ctx, chirpID); err != nil {
+		return nil, err
+	} 
+	if err := qtx.DeleteChirpMentions(ctx, chirpID); err != nil {
+		return nil, err
+	} 
+	attachments, err := qtx.DeleteChirpAttachments(ctx, chirpID)
+	if err != nil {
+		return nil, err
+	} 
+	if err := qtx.TombstoneChirp(ctx, chirpID); err != nil {
+		return nil, err
+	} 
+	return attachments, nil
+} 
+
+// referencedChirps is the parent, original or quoted chirp that a chirp
+// points at, if any.
+func referencedChirps(chirp database.Chirp) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, id := range []uuid.NullUUID{chirp.ParentID, chirp.RechirpOf, chirp.QuoteOf} {
+		if id.Valid {
+			ids = append(ids, id.UUID)
+		} 
+	} 
+	return ids
+} 
+
+// deleteUnreferencedTombstones deletes any of the chirps that are tombstones
+// nothing points at any more, after a chirp pointing at them was deleted.
+// That can free up their own parents, so it works its way up the thread.
+func deleteUnreferencedTombstones(ctx context.Context, qtx *database.Queries, chirpIDs ...uuid.UUID) error {
+	for len(chirpIDs) > 0 {
+		chirp, err := qtx.GetChirpForUpdate(ctx, chirpIDs[0])
+		chirpIDs = chirpIDs[1:]
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		} 
+		if err != nil {
+			return err
+		} 
+		if !chirp.DeletedAt.Valid {
+			continue
+		} 
+		referenced, err := isChirpReferenced(ctx, qtx, chirp)
+		if err != nil {
+			return err
+		} 
+		if referenced {
+			continue
+		} 
+		// A tombstone's attachments were already removed.
+		if err := qtx.DeleteChirp(ctx, chirp.ID); err != nil {
+			return err
+		} 
+		chirpIDs = append(chirpIDs, referencedChirps(chirp)...)
+	} 
+	return nil
+} 
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/auth"
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/JoStMc/Chirpy/internal/mail"
+	"github.com/google/uuid"
+)
+
+// unverifiedPolicy is what users can do before verifying their email.
+type unverifiedPolicy string
+
+const (
+	unverifiedAllow unverifiedPolicy = "allow"
+	// unverifiedRestrict gives unverified users read-only access to chirps,
+	// though they can still edit their profile, e.g. to fix their email.
+	unverifiedRestrict unverifiedPolicy = "restrict"
+	unverifiedBlock unverifiedPolicy = "block"
+)
+
+const (
+	tokenVerifyEmail = "verify_email"
+	tokenResetPassword = "reset_password"
+	verifyEmailExpiry = 24 * time.Hour
+	resetPasswordExpiry = time.Hour
+	// mailsPerHour is how many emails of each kind an address can be sent
+	// an hour, so the request endpoints can't be used to flood an inbox.
+	mailsPerHour = 3
+	sendMailTimeout = 30 * time.Second
+)
+
+var restrictedScopes = []string{scopeChirpsRead, scopeProfileWrite}
+
+func unverifiedPolicyFromEnv() (unverifiedPolicy, error) {
+	switch policy := unverifiedPolicy(os.Getenv("UNVERIFIED_ACCOUNTS")); policy {
+	case "":
+		return unverifiedAllow, nil
+	case unverifiedAllow, unverifiedRestrict, unverifiedBlock:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid UNVERIFIED_ACCOUNTS %q: must be allow, restrict or block", policy)
+	} 
+} 
+
+// loadMailer sends mail through MAIL_SMTP_ADDR if it's set, and otherwise
+// prints it to stdout for local development.
+func loadMailer() (mail.Mailer, error) {
+	addr := os.Getenv("MAIL_SMTP_ADDR")
+	if addr == "" {
+		log.Println("Warning: MAIL_SMTP_ADDR is not set, so emails are printed instead of sent")
+		return mail.NewLogMailer(os.Stdout), nil
+	} 
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		return nil, errors.New("MAIL_FROM must be set to send mail")
+	} 
+	return mail.NewSMTPMailer(addr, os.Getenv("MAIL_SMTP_USERNAME"), os.Getenv("MAIL_SMTP_PASSWORD"), from)
+} 
+
+// scopesFor is what a user's access tokens and API keys may be granted.
+func (cfg *apiConfig) scopesFor(emailVerified bool) []string {
+	if !emailVerified && cfg.unverifiedPolicy == unverifiedRestrict {
+		return restrictedScopes
+	} 
+	return allScopes
+} 
+
+// blocksUnverified reports whether a user must verify their email before
+// logging in.
+func (cfg *apiConfig) blocksUnverified(emailVerified bool) bool {
+	return !emailVerified && cfg.unverifiedPolicy == unverifiedBlock
+} 
+
+// sendUserToken emails the user a link with a new single-use token for
+// purpose, replacing any they were sent before. Addresses that have been
+// sent too many are silently skipped. The mail itself is sent in the
+// background, so responses don't reveal whether it went out.
+func (cfg *apiConfig) sendUserToken(ctx context.Context, userID uuid.UUID, email, purpose string) error {
+	if ok, _ := cfg.mailLimiter.Allow(purpose + ":" + strings.ToLower(email), mailsPerHour); !ok {
+		log.Printf("Not sending %s email to user %s: rate limited", purpose, userID)
+		return nil
+	} 
+
+	err := cfg.dbQueries.DeleteUserTokens(ctx, database.DeleteUserTokensParams{
+		UserID: userID,
+		Purpose: purpose,
+	})
+	if err != nil {
+		return err
+	} 
+	token := auth.MakeRefreshToken()
+	expiry := verifyEmailExpiry
+	if purpose == tokenResetPassword {
+		expiry = resetPasswordExpiry
+	} 
+	err = cfg.dbQueries.CreateUserToken(ctx, database.CreateUserTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID: userID,
+		Purpose: purpose,
+		Email: email,
+		ExpiresInSeconds: expiry.Seconds(),
+	})
+	if err != nil {
+		return err
+	} 
+
+	msg := mail.Message{To: email}
+	switch purpose {
+	case tokenVerifyEmail:
+		msg.Subject = "Verify your Chirpy email address"
+		msg.Body = fmt.Sprintf("Welcome to Chirpy! Confirm this is your email address by following this link within 24 hours:\n\n%s/verify-email?token=%s\n", cfg.appURL, token)
+	case tokenResetPassword:
+		msg.Subject = "Reset your Chirpy password"
+		msg.Body = fmt.Sprintf("Someone asked to reset the password of your Chirpy account. If it was you, follow this link within an hour to choose a new one:\n\n%s/reset-password?token=%s\n\nIf it wasn't, you can ignore this email.\n", cfg.appURL, token)
+	} 
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendMailTimeout)
+		defer cancel()
+		if err := cfg.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Error sending %s email to user %s: %v", purpose, userID, err)
+		} 
+	}()
+	return nil
+} 
+
+type emailRequest struct {
+	Email string `json:"email"`
+} 
+
+// handlerRequestEmailVerification sends a new verification link. It always
+// responds 202, so it can't be used to find out which emails have accounts.
+func (cfg *apiConfig) handlerRequestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[emailRequest](r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
+		return
+	} 
+	ctx := r.Context()
+
+	user, err := cfg.dbQueries.GetUser(ctx, params.Email)
+	if err == nil && !user.EmailVerifiedAt.Valid {
+		err = cfg.sendUserToken(ctx, user.ID, user.Email, tokenVerifyEmail)
+	} 
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error sending verification email: %v", err))
+		return
+	} 
+	w.WriteHeader(http.StatusAccepted)
+} 
+
+type tokenRequest struct {
+	Token string `json:"token"`
+} 
+
+func (cfg *apiConfig) handlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[tokenRequest](r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
+		return
+	} 
+	ctx := r.Context()
+
+	token, err := cfg.dbQueries.UseUserToken(ctx, database.UseUserTokenParams{
+		TokenHash: auth.HashToken(params.Token),
+		Purpose: tokenVerifyEmail,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	} 
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error verifying email: %v", err))
+		return
+	} 
+
+	user, err := cfg.dbQueries.VerifyUserEmail(ctx, database.VerifyUserEmailParams{
+		ID: token.UserID,
+		Email: token.Email,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "The email address has changed since this link was sent")
+		return
+	} 
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error verifying email: %v", err))
+		return
+	} 
+
+	plan, err := getUserPlan(ctx, cfg.dbQueries, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving plan: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, userFromDB(user, plan))
+} 
+
+// handlerRequestPasswordReset emails a reset link. Like verification, it
+// always responds 202.
+func (cfg *apiConfig) handlerRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[emailRequest](r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
+		return
+	} 
+	ctx := r.Context()
+
+	user, err := cfg.dbQueries.GetUser(ctx, params.Email)
+	if err == nil {
+		err = cfg.sendUserToken(ctx, user.ID, user.Email, tokenResetPassword)
+	} 
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error sending reset email: %v", err))
+		return
+	} 
+	w.WriteHeader(http.StatusAccepted)
+} 
+
+type confirmPasswordResetRequest struct {
+	Token string `json:"token"`
+	Password string `json:"password"`
+} 
+
+// handlerConfirmPasswordReset sets a new password and logs the user out
+// everywhere, in case the old one was how someone else got in.
+func (cfg *apiConfig) handlerConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[confirmPasswordResetRequest](r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
+		return
+	} 
+	if !cfg.checkNewPassword(w, params.Password) {
+		return
+	} 
+	hashedPassword, err := auth.HashPassword(params.Password, cfg.passwordParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error hashing password: %v", err))
+		return
+	} 
+	ctx := r.Context()
+
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error starting transaction: %v", err))
+		return
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	token, err := qtx.UseUserToken(ctx, database.UseUserTokenParams{
+		TokenHash: auth.HashToken(params.Token),
+		Purpose: tokenResetPassword,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	} 
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error resetting password: %v", err))
+		return
+	} 
+
+	user, err := qtx.UpdateUser(ctx, database.UpdateUserParams{
+		ID: token.UserID,
+		HashedPassword: sql.NullString{String: hashedPassword, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error resetting password: %v", err))
+		return
+	} 
+	if user.Email != token.Email {
+		respondWithError(w, http.StatusBadRequest, "The email address has changed since this link was sent")
+		return
+	} 
+
+	_, err = qtx.RevokeOtherUserRefreshTokens(ctx, database.RevokeOtherUserRefreshTokensParams{
+		UserID: user.ID,
+		KeepFamilyID: uuid.Nil,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error revoking sessions: %v", err))
+		return
+	} 
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error resetting password: %v", err))
+		return
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/JoStMc/Chirpy/internal/entitlements"
+	"github.com/google/uuid"
+)
+
+// dbPlanSource tells the entitlements service which plan a user is on.
+type dbPlanSource struct {
+	q *database.Queries
+} 
+
+func (s dbPlanSource) UserPlan(ctx context.Context, userID uuid.UUID) (entitlements.Plan, error) {
+	plan, err := getUserPlan(ctx, s.q, userID)
+	if err != nil {
+		return "", err
+	} 
+	return plan.Plan, nil
+} 
+
+// allowChirp applies the plan's posting rate limit, responding with 429 and
+// Retry-After when the user has posted too much.
+func (cfg *apiConfig) allowChirp(w http.ResponseWriter, userID uuid.UUID, limits entitlements.Limits) bool {
+	ok, retryAfter := cfg.chirpLimiter.Allow(userID.String(), limits.ChirpsPerHour)
+	if ok {
+		return true
+	} 
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	respondWithError(w, http.StatusTooManyRequests, fmt.Sprintf("You can post at most %d chirps an hour", limits.ChirpsPerHour))
+	return false
+} 
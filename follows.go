@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerFollowUser(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	} 
+	userID, err := cfg.scopedUserID(r, scopeProfileWrite)
+	if err != nil {
+		respondWithError(w, authErrorStatus(err), fmt.Sprint(err))
+		return
+	} 
+	if followeeID == userID {
+		respondWithError(w, http.StatusBadRequest, "Cannot follow yourself")
+		return
+	} 
+
+	ctx := r.Context()
+	if _, err := cfg.dbQueries.GetUserByID(ctx, followeeID); err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	} 
+
+	followed, err := cfg.dbQueries.FollowUser(ctx, database.FollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error following user: %v", err))
+		return
+	} 
+	if followed > 0 {
+		cfg.notifyBestEffort(ctx, followeeID, userID, notificationFollow, uuid.NullUUID{})
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
+
+func (cfg *apiConfig) handlerUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	} 
+	userID, err := cfg.scopedUserID(r, scopeProfileWrite)
+	if err != nil {
+		respondWithError(w, authErrorStatus(err), fmt.Sprint(err))
+		return
+	} 
+
+	_, err = cfg.dbQueries.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: userID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error unfollowing user: %v", err))
+		return
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
+
+func (cfg *apiConfig) handlerTimeline(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.scopedUserID(r, scopeChirpsRead)
+	if err != nil {
+		respondWithError(w, authErrorStatus(err), fmt.Sprint(err))
+		return
+	} 
+	p, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	} 
+
+	chirps, err := cfg.dbQueries.ListTimeline(r.Context(), database.ListTimelineParams{
+		UserID: userID,
+		AfterCreatedAt: p.afterCreatedAt(),
+		AfterID: p.afterID(),
+		Limit: p.queryLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving timeline: %v", err))
+		return
+	} 
+
+	n := setNextLink(w, r, p, len(chirps), func(i int) cursor {
+		return cursor{CreatedAt: chirps[i].CreatedAt, ID: chirps[i].ID}
+	})
+	apiChirps := make([]Chirp, n)
+	for i, c := range chirps[:n] {
+		apiChirps[i] = chirpFromDB(c)
+	} 
+	if err := cfg.populateChirps(r, apiChirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving timeline: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, apiChirps)
+} 
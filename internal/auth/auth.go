@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
@@ -13,8 +14,9 @@ import (
 	"github.com/google/uuid"
 )
 
-func HashPassword(password string) (string, error) {
-	return argon2id.CreateHash(password, argon2id.DefaultParams)
+// HashPassword hashes password with Argon2id using params.
+func HashPassword(password string, params PasswordParams) (string, error) {
+	return argon2id.CreateHash(password, params.argon2id())
 } 
 
 func CheckPasswordHash(password, hash string) (bool, error) {
@@ -22,44 +24,78 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 } 
 
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	registeredClaims := jwt.RegisteredClaims{
-		Issuer: "chirpy-access",
-		Subject: userID.String(),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		IssuedAt: jwt.NewNumericDate(time.Now()),
+// MakeJWT makes an access token for userID, signed with the active key in
+// keys. sessionID is the login session it was issued under, or uuid.Nil for
+// none, and scopes are what the token may be used for.
+func MakeJWT(userID, sessionID uuid.UUID, scopes []string, keys *KeySet, expiresIn time.Duration) (string, error) {
+	claims := CustomClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: "chirpy-access",
+			Subject: userID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Scope: strings.Join(scopes, " "),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, registeredClaims) 
-	return token.SignedString([]byte(tokenSecret))
+	if sessionID != uuid.Nil {
+		claims.SessionID = sessionID.String()
+	} 
+	return keys.sign(claims)
 } 
 
 type CustomClaims struct {
 	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	// Scope is the space separated scopes the token grants, as in RFC 8693.
+	Scope string `json:"scope,omitempty"`
+} 
+
+// UserID is the user the token was issued to.
+func (c *CustomClaims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+} 
+
+// Scopes are the scopes the token grants.
+func (c *CustomClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
 } 
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+// Session is the login session the token was issued under. Tokens issued
+// before sessions were tracked have none, and give uuid.Nil.
+func (c *CustomClaims) Session() uuid.UUID {
+	sessionID, err := uuid.Parse(c.SessionID)
+	if err != nil {
+		return uuid.Nil
+	} 
+	return sessionID
+} 
+
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, keys)
+	if err != nil {
+	    return uuid.Nil, err
+	}
+	return claims.UserID()
+} 
+
+// ParseJWT validates an access token against keys and returns its claims.
+func ParseJWT(tokenString string, keys *KeySet) (*CustomClaims, error) {
 	claims := &CustomClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		claims,
-		func(t *jwt.Token) (any, error) {
-			return []byte(tokenSecret), nil
-		},
+		keys.keyfunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
 	)
 
 	if err != nil {
-	    return uuid.Nil, err
+	    return nil, err
 	}
 
 	if !token.Valid {
-		return uuid.Nil, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
-
-	userIDString, err := claims.GetSubject()
-	if err != nil {
-	    return uuid.Nil, err
-	} 
-	return uuid.Parse(userIDString)
+	return claims, nil
 } 
 
 
@@ -69,6 +105,13 @@ func MakeRefreshToken() string {
 	return hex.EncodeToString(key)
 } 
 
+// HashToken returns the hex SHA-256 of a token. Refresh tokens are random, so
+// unlike passwords they don't need a slow, salted hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+} 
+
 
 func GetBearerToken(headers http.Header) (string, error) {
 	return getAuthKey(headers, "Bearer")
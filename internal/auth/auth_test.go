@@ -8,30 +8,97 @@ import (
 )
 
 func TestValidateJWT(t *testing.T) {
-	tokenSecret := "secretthing"
+	keys, err := GenerateKeySet()
+	if err != nil {
+		t.Fatalf("Error generating keys: %v", err)
+	} 
+	otherKeys, err := GenerateKeySet()
+	if err != nil {
+		t.Fatalf("Error generating keys: %v", err)
+	} 
 	userID := uuid.New()
 	expirationTime := 2 * time.Second
 
 
-	token, err := MakeJWT(userID, tokenSecret, expirationTime)
+	token, err := MakeJWT(userID, uuid.Nil, nil, keys, expirationTime)
 	if err != nil {
 		t.Errorf("Error making JWT: %v", err)
 	} 
 
-	validCase, err := ValidateJWT(token, tokenSecret)
+	validCase, err := ValidateJWT(token, keys)
 	if validCase != userID || err != nil {
 		t.Errorf("Validate failed: %v", err)
 	} 
 
-	invalidCase, err := ValidateJWT(token, "differentThing")
+	invalidCase, err := ValidateJWT(token, otherKeys)
 	if invalidCase == userID || err == nil {
 		t.Errorf("Validate failed: %v", err)
 	} 
 
 	time.Sleep(3 * time.Second)
 
-	_, err = ValidateJWT(token, tokenSecret)
+	_, err = ValidateJWT(token, keys)
 	if err == nil {
 		t.Errorf("Expected an error for an expired token")
 	} 
 }
+
+func TestParseJWTClaims(t *testing.T) {
+	keys, err := GenerateKeySet()
+	if err != nil {
+		t.Fatalf("Error generating keys: %v", err)
+	} 
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	token, err := MakeJWT(userID, sessionID, []string{"chirps:read", "chirps:write"}, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("Error making JWT: %v", err)
+	} 
+	claims, err := ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	} 
+	if got, err := claims.UserID(); got != userID || err != nil {
+		t.Errorf("UserID() = %v, %v, want %v", got, err, userID)
+	} 
+	if got := claims.Session(); got != sessionID {
+		t.Errorf("Session() = %v, want %v", got, sessionID)
+	} 
+	if got := claims.Scopes(); len(got) != 2 || got[0] != "chirps:read" || got[1] != "chirps:write" {
+		t.Errorf("Scopes() = %v, want [chirps:read chirps:write]", got)
+	} 
+
+	token, err = MakeJWT(userID, uuid.Nil, nil, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("Error making JWT: %v", err)
+	} 
+	claims, err = ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	} 
+	if got := claims.Session(); got != uuid.Nil {
+		t.Errorf("Session() = %v, want none", got)
+	} 
+	if got := claims.Scopes(); len(got) != 0 {
+		t.Errorf("Scopes() = %v, want none", got)
+	} 
+}
+
+func TestHashToken(t *testing.T) {
+	token := MakeRefreshToken()
+	hash := HashToken(token)
+	if hash == token || len(hash) != 64 {
+		t.Errorf("Expected a 64 character hash, got %q", hash)
+	} 
+	if HashToken(token) != hash {
+		t.Errorf("Expected hashing to be deterministic")
+	} 
+
+	// Must match Postgres' encode(sha256(...), 'hex'), used to migrate
+	// existing tokens.
+	want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got := HashToken("hello"); got != want {
+		t.Errorf("HashToken(\"hello\") = %s, want %s", got, want)
+	} 
+}
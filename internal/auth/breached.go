@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// breachedPrefixLength is the length of the hash prefix that ranges are
+// looked up by, as in the Pwned Passwords range API.
+const breachedPrefixLength = 5
+
+// maxBreachedLineLength bounds a line of the list: a 40 character hash, a
+// colon and a count.
+const maxBreachedLineLength = 64
+
+// BreachedList is a local copy of a breached password list such as Pwned
+// Passwords, in the format its downloader writes: one `<SHA-1>:<count>` line
+// per password, upper case hex, sorted by hash. The file is searched in
+// place, since the full list is tens of gigabytes. Like the range API, a
+// lookup reads the range of hashes sharing the password's 5 character hash
+// prefix, and matches the rest of the hash within it.
+type BreachedList struct {
+	f    *os.File
+	size int64
+}
+
+func OpenBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &BreachedList{f: f, size: info.Size()}, nil
+}
+
+func (l *BreachedList) Close() error {
+	return l.f.Close()
+}
+
+// Contains reports whether password is in the list.
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachedPrefixLength], hash[breachedPrefixLength:]
+
+	start, err := l.rangeStart(prefix)
+	if err != nil {
+		return false, err
+	}
+	scanner := bufio.NewScanner(io.NewSectionReader(l.f, start, l.size-start))
+	for scanner.Scan() {
+		lineHash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		lineHash = strings.ToUpper(lineHash)
+		if !strings.HasPrefix(lineHash, prefix) {
+			break
+		}
+		if lineHash[breachedPrefixLength:] == suffix {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// rangeStart binary searches for the offset of the first line whose hash
+// is at least prefix.
+func (l *BreachedList) rangeStart(prefix string) (int64, error) {
+	var searchErr error
+	// Whether the line starting at or after off sorts at or after prefix
+	// only ever goes from false to true as off grows.
+	off := sort.Search(int(l.size), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+		start, line, err := l.lineAt(int64(i))
+		if err != nil {
+			searchErr = err
+			return true
+		}
+		return start >= l.size || strings.ToUpper(string(line)) >= prefix
+	})
+	if searchErr != nil {
+		return 0, searchErr
+	}
+	start, _, err := l.lineAt(int64(off))
+	return start, err
+}
+
+// lineAt returns the first line that starts at or after off, and where it
+// starts.
+func (l *BreachedList) lineAt(off int64) (int64, []byte, error) {
+	start := off
+	if off > 0 {
+		// Read from the byte before off, in case a line starts exactly
+		// at off.
+		buf, err := l.read(off - 1)
+		if err != nil {
+			return 0, nil, err
+		}
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			return l.size, nil, nil
+		}
+		start = off + int64(i)
+	}
+	if start >= l.size {
+		return l.size, nil, nil
+	}
+	buf, err := l.read(start)
+	if err != nil {
+		return 0, nil, err
+	}
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[:i]
+	}
+	return start, buf, nil
+}
+
+func (l *BreachedList) read(off int64) ([]byte, error) {
+	buf := make([]byte, maxBreachedLineLength)
+	n, err := l.f.ReadAt(buf, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
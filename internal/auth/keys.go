@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA key accepted for signing tokens.
+const minRSABits = 2048
+
+// ErrUnknownKey means a token names a key ID that isn't in the key set.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// verificationKey is a public key that tokens can be checked against, along
+// with the algorithm it was made for.
+type verificationKey struct {
+	method jwt.SigningMethod
+	public crypto.PublicKey
+}
+
+// KeySet holds the key that new tokens are signed with and every key that
+// tokens are still accepted from, each by key ID (`kid`). Keys are rotated by
+// adding a new key, making it active once other services have fetched it,
+// and keeping the old public key until the tokens it signed have expired.
+type KeySet struct {
+	activeID string
+	signers  map[string]crypto.Signer
+	keys     map[string]verificationKey
+}
+
+// LoadKeySet reads PEM keys from dir, one per file, named `<kid>.pem`. A
+// PKCS #8 private key can sign and verify; a PKIX public key only verifies,
+// for keys being retired. RSA (RS256) and Ed25519 (EdDSA) keys are
+// supported. activeID names the private key that new tokens are signed with.
+func LoadKeySet(dir, activeID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	ks := newKeySet()
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		signer, public, err := parseKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", kid, err)
+		}
+		if err := ks.add(kid, signer, public); err != nil {
+			return nil, fmt.Errorf("key %s: %w", kid, err)
+		}
+	}
+	if err := ks.activate(activeID); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// GenerateKeySet makes a set with a single new Ed25519 key. Tokens it signs
+// stop validating when the process exits, so it's only for development.
+func GenerateKeySet() (*KeySet, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	kid := hex.EncodeToString(id)
+
+	ks := newKeySet()
+	if err := ks.add(kid, private, public); err != nil {
+		return nil, err
+	}
+	if err := ks.activate(kid); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func newKeySet() *KeySet {
+	return &KeySet{
+		signers: map[string]crypto.Signer{},
+		keys:    map[string]verificationKey{},
+	}
+}
+
+func parseKeyPEM(data []byte) (crypto.Signer, crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("no PEM data")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, signer.Public(), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, key, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+func (ks *KeySet) add(kid string, signer crypto.Signer, public crypto.PublicKey) error {
+	if _, ok := ks.keys[kid]; ok {
+		return errors.New("duplicate key ID")
+	}
+	var method jwt.SigningMethod
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSABits {
+			return fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+		}
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return fmt.Errorf("unsupported key type %T", public)
+	}
+	ks.keys[kid] = verificationKey{method: method, public: public}
+	if signer != nil {
+		ks.signers[kid] = signer
+	}
+	return nil
+}
+
+func (ks *KeySet) activate(kid string) error {
+	if kid == "" {
+		return errors.New("no active key ID set")
+	}
+	if _, ok := ks.signers[kid]; !ok {
+		return fmt.Errorf("active key %q not found or has no private key", kid)
+	}
+	ks.activeID = kid
+	return nil
+}
+
+// sign signs claims with the active key, naming it in the `kid` header.
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.keys[ks.activeID].method, claims)
+	token.Header["kid"] = ks.activeID
+	return token.SignedString(ks.signers[ks.activeID])
+}
+
+// keyfunc finds the key a token was signed with. The token's algorithm must
+// be the one that key is for, so a public key can never be used as an HMAC
+// secret.
+func (ks *KeySet) keyfunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys tokens are accepted from, ordered by key ID,
+// so other services can verify tokens themselves.
+func (ks *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKS{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk := JWK{KeyID: kid, Use: "sig", Algorithm: key.method.Alg()}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func writePrivateKey(t *testing.T, dir, kid string, key crypto.Signer) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid, "PRIVATE KEY", der)
+}
+
+func writePublicKey(t *testing.T, dir, kid string, key crypto.PublicKey) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, kid, "PUBLIC KEY", der)
+}
+
+func writePEM(t *testing.T, dir, kid, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+
+	// Before: tokens are signed with the RSA key.
+	oldDir := t.TempDir()
+	writePrivateKey(t, oldDir, "2024-rsa", rsaKey)
+	oldKeys, err := LoadKeySet(oldDir, "2024-rsa")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	oldToken, err := MakeJWT(userID, uuid.Nil, nil, oldKeys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	// After: the Ed25519 key signs, and the RSA key only verifies.
+	newDir := t.TempDir()
+	writePublicKey(t, newDir, "2024-rsa", rsaKey.Public())
+	writePrivateKey(t, newDir, "2025-ed", edKey)
+	newKeys, err := LoadKeySet(newDir, "2025-ed")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	newToken, err := MakeJWT(userID, uuid.Nil, nil, newKeys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		keys  *KeySet
+		ok    bool
+	}{
+		{"old token, old keys", oldToken, oldKeys, true},
+		{"old token, rotated keys", oldToken, newKeys, true},
+		{"new token, rotated keys", newToken, newKeys, true},
+		{"new token, old keys", newToken, oldKeys, false},
+	}
+	for _, c := range cases {
+		got, err := ValidateJWT(c.token, c.keys)
+		if c.ok && (err != nil || got != userID) {
+			t.Errorf("%s: got %v, %v, want %v", c.name, got, err, userID)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+	}
+
+	if _, err := ValidateJWT(newToken, oldKeys); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Expected ErrUnknownKey, got %v", err)
+	}
+	header, _, _ := jwt.NewParser().ParseUnverified(newToken, &CustomClaims{})
+	if header.Header["kid"] != "2025-ed" || header.Method.Alg() != "EdDSA" {
+		t.Errorf("Unexpected header %v", header.Header)
+	}
+}
+
+func TestRejectsOtherAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "main", rsaKey)
+	keys, err := LoadKeySet(dir, "main")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+	claims := CustomClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   uuid.NewString(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+
+	// An HMAC token keyed with the public key, which anyone can fetch.
+	publicDER, err := x509.MarshalPKIXPublicKey(rsaKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmacToken.Header["kid"] = "main"
+	signed, err := hmacToken.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseJWT(signed, keys); err == nil {
+		t.Error("Expected an HS256 token to be rejected")
+	}
+
+	noneToken := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	noneToken.Header["kid"] = "main"
+	signed, err = noneToken.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseJWT(signed, keys); err == nil {
+		t.Error("Expected an unsigned token to be rejected")
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "main", rsaKey)
+	if _, err := LoadKeySet(dir, "missing"); err == nil {
+		t.Error("Expected an error for a missing active key")
+	}
+	if _, err := LoadKeySet(dir, ""); err == nil {
+		t.Error("Expected an error for no active key")
+	}
+
+	dir = t.TempDir()
+	writePublicKey(t, dir, "main", rsaKey.Public())
+	if _, err := LoadKeySet(dir, "main"); err == nil {
+		t.Error("Expected an error for a public-only active key")
+	}
+
+	dir = t.TempDir()
+	writePrivateKey(t, dir, "small", smallKey)
+	if _, err := LoadKeySet(dir, "small"); err == nil {
+		t.Error("Expected an error for a small RSA key")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "a-rsa", rsaKey)
+	writePrivateKey(t, dir, "b-ed", edKey)
+	keys, err := LoadKeySet(dir, "b-ed")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(set.Keys))
+	}
+	rsaJWK, edJWK := set.Keys[0], set.Keys[1]
+	if rsaJWK.KeyID != "a-rsa" || rsaJWK.KeyType != "RSA" || rsaJWK.Algorithm != "RS256" || rsaJWK.E != "AQAB" || rsaJWK.N == "" {
+		t.Errorf("Unexpected RSA key %+v", rsaJWK)
+	}
+	if edJWK.KeyID != "b-ed" || edJWK.KeyType != "OKP" || edJWK.Curve != "Ed25519" || edJWK.Algorithm != "EdDSA" {
+		t.Errorf("Unexpected Ed25519 key %+v", edJWK)
+	}
+	if x, err := base64.RawURLEncoding.DecodeString(edJWK.X); err != nil || !edPublic.Equal(ed25519.PublicKey(x)) {
+		t.Errorf("Unexpected Ed25519 x %q", edJWK.X)
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// PasswordParams are the Argon2id costs passwords are hashed with. Raising
+// them makes hashes slower to compute, for us and for anyone guessing.
+type PasswordParams struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// defaultParallelism is fixed rather than taken from the CPU count, which is
+// what the argon2id package does. Otherwise moving to a machine with a
+// different number of CPUs would change the parameters and rehash every
+// password on its next login.
+const defaultParallelism = 2
+
+// DefaultPasswordParams are the argon2id package's memory and iterations,
+// 64 MiB and one, with two threads.
+func DefaultPasswordParams() PasswordParams {
+	return PasswordParams{
+		Memory:      argon2id.DefaultParams.Memory,
+		Iterations:  argon2id.DefaultParams.Iterations,
+		Parallelism: defaultParallelism,
+	}
+}
+
+// PasswordParamsFromEnv starts from DefaultPasswordParams and overrides any
+// of ARGON2_MEMORY (KiB), ARGON2_ITERATIONS and ARGON2_PARALLELISM that are
+// set.
+func PasswordParamsFromEnv(getenv func(string) string) (PasswordParams, error) {
+	params := DefaultPasswordParams()
+	if err := uintFromEnv(getenv, "ARGON2_MEMORY", 32, func(v uint64) { params.Memory = uint32(v) }); err != nil {
+		return PasswordParams{}, err
+	}
+	if err := uintFromEnv(getenv, "ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }); err != nil {
+		return PasswordParams{}, err
+	}
+	if err := uintFromEnv(getenv, "ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }); err != nil {
+		return PasswordParams{}, err
+	}
+	// Argon2 needs at least 8 KiB of memory per thread.
+	if params.Iterations < 1 || params.Parallelism < 1 || params.Memory < 8*uint32(params.Parallelism) {
+		return PasswordParams{}, fmt.Errorf("invalid Argon2 parameters %+v", params)
+	}
+	return params, nil
+}
+
+func uintFromEnv(getenv func(string) string, key string, bits int, set func(uint64)) error {
+	value := getenv(key)
+	if value == "" {
+		return nil
+	}
+	v, err := strconv.ParseUint(value, 10, bits)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %q", key, value)
+	}
+	set(v)
+	return nil
+}
+
+func (p PasswordParams) argon2id() *argon2id.Params {
+	return &argon2id.Params{
+		Memory:      p.Memory,
+		Iterations:  p.Iterations,
+		Parallelism: p.Parallelism,
+		SaltLength:  argon2id.DefaultParams.SaltLength,
+		KeyLength:   argon2id.DefaultParams.KeyLength,
+	}
+}
+
+// NeedsRehash reports whether hash was made with parameters other than
+// params, so it should be replaced the next time the password is known.
+func NeedsRehash(hash string, params PasswordParams) bool {
+	current, salt, key, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return true
+	}
+	want := params.argon2id()
+	return current.Memory != want.Memory ||
+		current.Iterations != want.Iterations ||
+		current.Parallelism != want.Parallelism ||
+		uint32(len(salt)) != want.SaltLength ||
+		uint32(len(key)) != want.KeyLength
+}
+
+// dummyHashes holds a hash of no one's password for each set of parameters,
+// made on first use.
+var dummyHashes sync.Map
+
+// CheckDummyPassword does the work of checking a password when there's no
+// user to check it against, so a login for an email without an account
+// takes as long to fail as one with the wrong password.
+func CheckDummyPassword(password string, params PasswordParams) {
+	hash, ok := dummyHashes.Load(params)
+	if !ok {
+		created, err := HashPassword(MakeRefreshToken(), params)
+		if err != nil {
+			return
+		}
+		hash, _ = dummyHashes.LoadOrStore(params, created)
+	}
+	argon2id.ComparePasswordAndHash(password, hash.(string))
+}
+
+// ErrWeakPassword is wrapped by the errors PasswordPolicy.Check returns for
+// passwords it doesn't accept.
+var ErrWeakPassword = errors.New("password not allowed")
+
+// PasswordPolicy is what a new password must satisfy.
+type PasswordPolicy struct {
+	MinLength int
+	// Breached, if set, is a list of passwords known from data breaches.
+	Breached *BreachedList
+}
+
+// Check returns an error wrapping ErrWeakPassword if password breaks the
+// policy, or another error if the breached list couldn't be read.
+func (p PasswordPolicy) Check(password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrWeakPassword, p.MinLength)
+	}
+	if p.Breached == nil {
+		return nil
+	}
+	breached, err := p.Breached.Contains(password)
+	if err != nil {
+		return err
+	}
+	if breached {
+		return fmt.Errorf("%w: it has appeared in a data breach, so choose another", ErrWeakPassword)
+	}
+	return nil
+}
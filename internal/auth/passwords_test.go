@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var testPasswordParams = PasswordParams{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestNeedsRehash(t *testing.T) {
+	hash, err := HashPassword("hunter22", testPasswordParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := CheckPasswordHash("hunter22", hash); !ok || err != nil {
+		t.Fatalf("CheckPasswordHash = %v, %v", ok, err)
+	}
+	if NeedsRehash(hash, testPasswordParams) {
+		t.Error("Expected a hash with the current parameters not to need rehashing")
+	}
+	stronger := testPasswordParams
+	stronger.Iterations = 2
+	if !NeedsRehash(hash, stronger) {
+		t.Error("Expected a hash with fewer iterations to need rehashing")
+	}
+	if !NeedsRehash("not a hash", testPasswordParams) {
+		t.Error("Expected an invalid hash to need rehashing")
+	}
+}
+
+func TestDefaultPasswordParams(t *testing.T) {
+	params, err := PasswordParamsFromEnv(func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("PasswordParamsFromEnv: %v", err)
+	}
+	if want := (PasswordParams{Memory: 64 * 1024, Iterations: 1, Parallelism: 2}); params != want {
+		t.Errorf("Got %+v, want %+v", params, want)
+	}
+}
+
+func TestPasswordParamsFromEnv(t *testing.T) {
+	env := map[string]string{"ARGON2_MEMORY": "19456", "ARGON2_ITERATIONS": "2", "ARGON2_PARALLELISM": "1"}
+	params, err := PasswordParamsFromEnv(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("PasswordParamsFromEnv: %v", err)
+	}
+	if want := (PasswordParams{Memory: 19456, Iterations: 2, Parallelism: 1}); params != want {
+		t.Errorf("Got %+v, want %+v", params, want)
+	}
+
+	for _, bad := range []map[string]string{
+		{"ARGON2_ITERATIONS": "0"},
+		{"ARGON2_PARALLELISM": "300"},
+		{"ARGON2_MEMORY": "lots"},
+		{"ARGON2_MEMORY": "8", "ARGON2_PARALLELISM": "4"},
+	} {
+		if _, err := PasswordParamsFromEnv(func(key string) string { return bad[key] }); err == nil {
+			t.Errorf("Expected an error for %v", bad)
+		}
+	}
+}
+
+// writeBreachedList writes a list in the Pwned Passwords format, with
+// filler hashes so that the search has something to do.
+func writeBreachedList(t *testing.T, passwords ...string) string {
+	t.Helper()
+	var lines []string
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":42")
+	}
+	for i := range 1000 {
+		sum := sha1.Sum([]byte(fmt.Sprint("filler", i)))
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), i+1))
+	}
+	sort.Strings(lines)
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBreachedList(t *testing.T) {
+	list, err := OpenBreachedList(writeBreachedList(t, "password", "123456", "correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+
+	cases := map[string]bool{
+		"password":             true,
+		"123456":               true,
+		"correct horse":        true,
+		"filler0":              true,
+		"filler999":            true,
+		"Password":             false,
+		"correct horse staple": false,
+		"":                     false,
+	}
+	for password, want := range cases {
+		got, err := list.Contains(password)
+		if err != nil {
+			t.Fatalf("Contains(%q): %v", password, err)
+		}
+		if got != want {
+			t.Errorf("Contains(%q) = %v, want %v", password, got, want)
+		}
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	list, err := OpenBreachedList(writeBreachedList(t, "password123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+	policy := PasswordPolicy{MinLength: 8, Breached: list}
+
+	for _, weak := range []string{"short", "pässwö", "password123"} {
+		if err := policy.Check(weak); !errors.Is(err, ErrWeakPassword) {
+			t.Errorf("Check(%q) = %v, want ErrWeakPassword", weak, err)
+		}
+	}
+	if err := policy.Check("a perfectly fine passphrase"); err != nil {
+		t.Errorf("Check: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// TOTPDigits and TOTPPeriod are the defaults every authenticator app
+	// supports: six digit SHA-1 codes that change every 30 seconds.
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+	// totpSkew is how many periods either side of now are accepted, to
+	// allow for clock drift and slow typing.
+	totpSkew       = 1
+	totpSecretSize = 20
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random secret, base32 encoded as authenticator
+// apps expect.
+func GenerateTOTPSecret() string {
+	secret := make([]byte, totpSecretSize)
+	rand.Read(secret)
+	return base32NoPadding.EncodeToString(secret)
+}
+
+// TOTPURI returns the otpauth:// URI that authenticator apps read, usually
+// from a QR code, to add an account.
+func TOTPURI(secret, issuer, account string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTPDigits))
+	query.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// TOTPCode returns the code for secret at t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, totpStep(t, TOTPPeriod), TOTPDigits, sha1.New), nil
+}
+
+// ValidateTOTP checks code against secret at now, allowing for a little
+// clock drift. It returns the time step the code was for, which callers
+// should record so that a code can't be used twice.
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(code) != TOTPDigits {
+		return 0, false
+	}
+	step := totpStep(now, TOTPPeriod)
+	for s := step - totpSkew; s <= step+totpSkew; s++ {
+		want := totpCode(key, s, TOTPDigits, sha1.New)
+		if subtle.ConstantTimeCompare([]byte(code), []byte(want)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.TrimRight(strings.ReplaceAll(secret, " ", ""), "="))
+	return base32NoPadding.DecodeString(secret)
+}
+
+func totpStep(t time.Time, period time.Duration) int64 {
+	return t.Unix() / int64(period.Seconds())
+}
+
+// totpCode is the HOTP value (RFC 4226) of key for a time step, as TOTP
+// (RFC 6238) defines it.
+func totpCode(key []byte, step int64, digits int, h func() hash.Hash) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(h, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for range digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// recoveryCodeAlphabet leaves out characters that are easily confused.
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// MakeRecoveryCodes returns n single-use codes, formatted like "abcde-fghjk",
+// for logging in without the authenticator. Store them with HashToken after
+// NormalizeRecoveryCode.
+func MakeRecoveryCodes(n int) []string {
+	// Bytes past the last multiple of the alphabet size are skipped, so
+	// every character is equally likely.
+	limit := byte(256 / len(recoveryCodeAlphabet) * len(recoveryCodeAlphabet))
+	codes := make([]string, n)
+	var buf [1]byte
+	for i := range codes {
+		code := make([]byte, 0, 10)
+		for len(code) < cap(code) {
+			rand.Read(buf[:])
+			if buf[0] < limit {
+				code = append(code, recoveryCodeAlphabet[int(buf[0])%len(recoveryCodeAlphabet)])
+			}
+		}
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+	}
+	return codes
+}
+
+// NormalizeRecoveryCode puts a recovery code the way a user typed it into the
+// form it was issued in, minus the dash.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
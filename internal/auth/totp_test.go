@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The test vectors from RFC 6238, appendix B.
+func TestTOTPRFC6238(t *testing.T) {
+	keys := map[string]struct {
+		key []byte
+		h   func() hash.Hash
+	}{
+		"SHA1":   {[]byte("12345678901234567890"), sha1.New},
+		"SHA256": {[]byte("12345678901234567890123456789012"), sha256.New},
+		"SHA512": {[]byte("1234567890123456789012345678901234567890123456789012345678901234"), sha512.New},
+	}
+	vectors := []struct {
+		unix int64
+		mode string
+		want string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+	for _, v := range vectors {
+		k := keys[v.mode]
+		step := totpStep(time.Unix(v.unix, 0), TOTPPeriod)
+		if got := totpCode(k.key, step, 8, k.h); got != v.want {
+			t.Errorf("%s at %d: got %s, want %s", v.mode, v.unix, got, v.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// The RFC's SHA-1 key, base32 encoded.
+	secret := base32NoPadding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode: %v", err)
+	}
+	// The last six digits of the RFC's eight digit code.
+	if code != "050471" {
+		t.Errorf("TOTPCode = %s, want 050471", code)
+	}
+
+	step := totpStep(now, TOTPPeriod)
+	cases := []struct {
+		name     string
+		at       time.Time
+		code     string
+		wantStep int64
+		ok       bool
+	}{
+		{"now", now, code, step, true},
+		{"one period late", now.Add(TOTPPeriod), code, step, true},
+		{"one period early", now.Add(-TOTPPeriod), code, step, true},
+		{"too late", now.Add(3 * TOTPPeriod), code, 0, false},
+		{"wrong code", now, "000000", 0, false},
+		{"wrong length", now, code + "0", 0, false},
+	}
+	for _, c := range cases {
+		gotStep, ok := ValidateTOTP(secret, c.code, c.at)
+		if ok != c.ok || gotStep != c.wantStep {
+			t.Errorf("%s: got %d, %v, want %d, %v", c.name, gotStep, ok, c.wantStep, c.ok)
+		}
+	}
+
+	// Authenticator apps may show the secret lowercased and in groups.
+	spaced := strings.ToLower(secret[:4] + " " + secret[4:])
+	if _, ok := ValidateTOTP(spaced, code, now); !ok {
+		t.Errorf("Expected a lowercase, spaced secret to validate")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret := GenerateTOTPSecret()
+	if len(secret) != 32 {
+		t.Errorf("Expected a 32 character secret, got %q", secret)
+	}
+	uri, err := url.Parse(TOTPURI(secret, "Chirpy", "saul@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Chirpy:saul@example.com" {
+		t.Errorf("Unexpected URI %s", uri)
+	}
+	query := uri.Query()
+	if query.Get("secret") != secret || query.Get("issuer") != "Chirpy" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("Unexpected query %s", uri.RawQuery)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes := MakeRecoveryCodes(10)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("Unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Errorf("Duplicate code %q", code)
+		}
+		seen[code] = true
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+		if NormalizeRecoveryCode(typed) != NormalizeRecoveryCode(code) {
+			t.Errorf("%q didn't normalize to the same as %q", typed, code)
+		}
+	}
+}
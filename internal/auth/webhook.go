@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookSignatureHeader carries a webhook's signature in the form
+// "t=<unix seconds>,v1=<hex HMAC-SHA256>". There may be more than one v1
+// while the sender is rotating secrets.
+const WebhookSignatureHeader = "Polka-Signature"
+
+var (
+	ErrNoSignature        = errors.New("webhook signature not found")
+	ErrInvalidSignature   = errors.New("webhook signature does not match")
+	ErrSignatureExpired   = errors.New("webhook timestamp outside tolerance")
+	ErrMalformedSignature = errors.New("malformed webhook signature")
+)
+
+// SignWebhook returns the v1 signature of body sent at timestamp.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the signature header against body. It accepts a
+// signature made with any of secrets, and rejects timestamps more than
+// tolerance away from now so a captured request can't be replayed later.
+func VerifyWebhook(headers http.Header, body []byte, secrets []string, tolerance time.Duration, now time.Time) error {
+	header := headers.Get(WebhookSignatureHeader)
+	if header == "" {
+		return ErrNoSignature
+	}
+
+	var timestamp int64
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrMalformedSignature
+		}
+		switch key {
+		case "t":
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrMalformedSignature
+			}
+			timestamp = t
+		case "v1":
+			sig, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrMalformedSignature
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return ErrMalformedSignature
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: sent %v ago", ErrSignatureExpired, age.Round(time.Second))
+	}
+
+	for _, secret := range secrets {
+		expected, _ := hex.DecodeString(SignWebhook(secret, timestamp, body))
+		for _, sig := range signatures {
+			if hmac.Equal(expected, sig) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"id":"evt_1","event":"user.upgraded"}`)
+	now := time.Unix(1700000000, 0)
+	tolerance := 5 * time.Minute
+	secrets := []string{"new-secret", "old-secret"}
+
+	header := func(timestamp int64, sigs ...string) http.Header {
+		h := http.Header{}
+		value := fmt.Sprintf("t=%d", timestamp)
+		for _, sig := range sigs {
+			value += ",v1=" + sig
+		}
+		h.Set(WebhookSignatureHeader, value)
+		return h
+	}
+
+	cases := []struct {
+		name    string
+		headers http.Header
+		body    []byte
+		want    error
+	}{
+		{"current secret", header(now.Unix(), SignWebhook("new-secret", now.Unix(), body)), body, nil},
+		{"rotated secret", header(now.Unix(), SignWebhook("old-secret", now.Unix(), body)), body, nil},
+		{"one of several signatures", header(now.Unix(), "00ff", SignWebhook("new-secret", now.Unix(), body)), body, nil},
+		{"wrong secret", header(now.Unix(), SignWebhook("other", now.Unix(), body)), body, ErrInvalidSignature},
+		{"tampered body", header(now.Unix(), SignWebhook("new-secret", now.Unix(), body)), []byte(`{}`), ErrInvalidSignature},
+		{"too old", header(now.Add(-time.Hour).Unix(), SignWebhook("new-secret", now.Add(-time.Hour).Unix(), body)), body, ErrSignatureExpired},
+		{"missing", http.Header{}, body, ErrNoSignature},
+		{"malformed", header(now.Unix(), "not-hex"), body, ErrMalformedSignature},
+	}
+	for _, c := range cases {
+		err := VerifyWebhook(c.headers, c.body, secrets, tolerance, now)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
@@ -6,33 +6,211 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	KeyHash    string
+	Prefix     string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+}
+
 type Chirp struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.UUID
+	ParentID     uuid.NullUUID
+	ReplyCount   int32
+	DeletedAt    sql.NullTime
+	LikeCount    int32
+	RechirpOf    uuid.NullUUID
+	QuoteOf      uuid.NullUUID
+	RechirpCount int32
+}
+
+type ChirpAttachment struct {
+	ID          uuid.UUID
+	ChirpID     uuid.UUID
+	Position    int32
+	ContentType string
+	BlobKey     string
+	Width       int32
+	Height      int32
+	ThumbKey    string
+	ThumbWidth  int32
+	ThumbHeight int32
+	CreatedAt   time.Time
+}
+
+type ChirpMention struct {
+	ChirpID uuid.UUID
+	UserID  uuid.UUID
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type ChirpTag struct {
+	ChirpID   uuid.UUID
+	Tag       string
+	CreatedAt time.Time
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Like struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type Notification struct {
 	ID        uuid.UUID
+	UserID    uuid.UUID
+	ActorID   uuid.UUID
+	Kind      string
+	ChirpID   uuid.NullUUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
+	ReadAt    sql.NullTime
+}
+
+type PolkaEvent struct {
+	ID         string
+	Event      string
+	ReceivedAt time.Time
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
 	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
 }
 
 type RefreshToken struct {
-	Token     string
+	TokenHash string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	UserID    uuid.UUID
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	FamilyID  uuid.UUID
+}
+
+type ScheduledChirp struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Body      string
+	ParentID  uuid.NullUUID
+	QuoteOf   uuid.NullUUID
+	PublishAt time.Time
+	CreatedAt time.Time
+	Attempts  int32
+	LastError sql.NullString
+	RetryAt   sql.NullTime
+	FailedAt  sql.NullTime
+}
+
+type Session struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	UserAgent  string
+	Ip         string
+}
+
+type Subscription struct {
+	UserID             uuid.UUID
+	Plan               string
+	Status             string
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+type SubscriptionEvent struct {
+	ID               uuid.UUID
+	UserID           uuid.UUID
+	Event            string
+	Status           string
+	CurrentPeriodEnd time.Time
+	PolkaEventID     sql.NullString
+	CreatedAt        time.Time
+}
+
+type TwoFactorChallenge struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Attempts  int32
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	FollowerCount   int32
+	FollowingCount  int32
+	Handle          sql.NullString
+	DisplayName     string
+	Bio             string
+	EmailVerifiedAt sql.NullTime
+	Role            string
+}
+
+type UserToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Purpose   string
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	Secret       string
+	CreatedAt    time.Time
+	EnabledAt    sql.NullTime
+	LastUsedStep int64
+}
+
+type WebhookDelivery struct {
+	ID           uuid.UUID
+	EventID      sql.NullString
+	Event        sql.NullString
+	Headers      json.RawMessage
+	Body         []byte
+	ReceivedAt   time.Time
+	Status       string
+	ResponseCode sql.NullInt32
+	Error        sql.NullString
+	Attempts     int32
+	ProcessedAt  sql.NullTime
 }
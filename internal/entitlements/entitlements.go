@@ -0,0 +1,169 @@
+// Package entitlements decides what each Chirpy plan allows, so handlers ask
+// one place instead of hard-coding limits.
+package entitlements
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Plan string
+
+const (
+	Free Plan = "free"
+	Red  Plan = "red"
+)
+
+// Plans lists every plan, cheapest first.
+var Plans = []Plan{Free, Red}
+
+// Limits is what a plan entitles its users to.
+type Limits struct {
+	MaxChirpLength   int
+	EditWindow       time.Duration
+	MaxAttachments   int
+	ScheduledPosting bool
+	// ChirpsPerHour caps how fast a user can post. Zero means no limit.
+	ChirpsPerHour int
+}
+
+// Table holds the limits for each plan.
+type Table map[Plan]Limits
+
+// Defaults returns the limits used when nothing is configured.
+func Defaults() Table {
+	return Table{
+		Free: {
+			MaxChirpLength:   140,
+			EditWindow:       15 * time.Minute,
+			MaxAttachments:   4,
+			ScheduledPosting: false,
+			ChirpsPerHour:    60,
+		},
+		Red: {
+			MaxChirpLength:   1000,
+			EditWindow:       time.Hour,
+			MaxAttachments:   8,
+			ScheduledPosting: true,
+			ChirpsPerHour:    600,
+		},
+	}
+}
+
+// FromEnv starts from Defaults and overrides any limit set in the
+// environment as <PLAN>_<LIMIT>, for example RED_MAX_CHIRP_LENGTH=500 or
+// FREE_EDIT_WINDOW=5m.
+func FromEnv(getenv func(string) string) (Table, error) {
+	table := Defaults()
+	for _, plan := range Plans {
+		limits := table[plan]
+		prefix := strings.ToUpper(string(plan)) + "_"
+		if err := intFromEnv(getenv, prefix+"MAX_CHIRP_LENGTH", &limits.MaxChirpLength); err != nil {
+			return nil, err
+		}
+		if err := intFromEnv(getenv, prefix+"MAX_ATTACHMENTS", &limits.MaxAttachments); err != nil {
+			return nil, err
+		}
+		if err := intFromEnv(getenv, prefix+"CHIRPS_PER_HOUR", &limits.ChirpsPerHour); err != nil {
+			return nil, err
+		}
+		if value := getenv(prefix + "EDIT_WINDOW"); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid %sEDIT_WINDOW: %q", prefix, value)
+			}
+			limits.EditWindow = d
+		}
+		if value := getenv(prefix + "SCHEDULED_POSTING"); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %sSCHEDULED_POSTING: %q", prefix, value)
+			}
+			limits.ScheduledPosting = b
+		}
+		if limits.MaxChirpLength < 1 {
+			return nil, fmt.Errorf("%sMAX_CHIRP_LENGTH must be at least 1", prefix)
+		}
+		table[plan] = limits
+	}
+	return table, nil
+}
+
+func intFromEnv(getenv func(string) string, key string, dst *int) error {
+	value := getenv(key)
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid %s: %q", key, value)
+	}
+	*dst = n
+	return nil
+}
+
+// For returns the limits of a plan. Unknown plans get the free limits.
+func (t Table) For(plan Plan) Limits {
+	if limits, ok := t[plan]; ok {
+		return limits
+	}
+	return t[Free]
+}
+
+// Max returns the most generous value of each limit across all plans. It
+// bounds work that happens before the user is known, such as how much of a
+// request body to read.
+func (t Table) Max() Limits {
+	var m Limits
+	unlimited := false
+	for _, limits := range t {
+		m.MaxChirpLength = max(m.MaxChirpLength, limits.MaxChirpLength)
+		m.EditWindow = max(m.EditWindow, limits.EditWindow)
+		m.MaxAttachments = max(m.MaxAttachments, limits.MaxAttachments)
+		m.ScheduledPosting = m.ScheduledPosting || limits.ScheduledPosting
+		m.ChirpsPerHour = max(m.ChirpsPerHour, limits.ChirpsPerHour)
+		unlimited = unlimited || limits.ChirpsPerHour == 0
+	}
+	if unlimited {
+		m.ChirpsPerHour = 0
+	}
+	return m
+}
+
+// PlanSource looks up which plan a user is on.
+type PlanSource interface {
+	UserPlan(ctx context.Context, userID uuid.UUID) (Plan, error)
+}
+
+// Checker is how handlers find out what a user is allowed to do.
+type Checker interface {
+	Limits(ctx context.Context, userID uuid.UUID) (Limits, error)
+	Max() Limits
+}
+
+// Service is a Checker backed by a Table and a PlanSource.
+type Service struct {
+	table  Table
+	source PlanSource
+}
+
+func New(table Table, source PlanSource) *Service {
+	return &Service{table: table, source: source}
+}
+
+func (s *Service) Limits(ctx context.Context, userID uuid.UUID) (Limits, error) {
+	plan, err := s.source.UserPlan(ctx, userID)
+	if err != nil {
+		return Limits{}, err
+	}
+	return s.table.For(plan), nil
+}
+
+func (s *Service) Max() Limits {
+	return s.table.Max()
+}
@@ -0,0 +1,67 @@
+package entitlements
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestFromEnv(t *testing.T) {
+	env := map[string]string{
+		"RED_MAX_CHIRP_LENGTH": "500",
+		"FREE_EDIT_WINDOW":     "5m",
+		"FREE_CHIRPS_PER_HOUR": "0",
+	}
+	table, err := FromEnv(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("FromEnv failed: %v", err)
+	}
+	if got := table.For(Red).MaxChirpLength; got != 500 {
+		t.Errorf("Red MaxChirpLength = %d, want 500", got)
+	}
+	if got := table.For(Free).EditWindow; got != 5*time.Minute {
+		t.Errorf("Free EditWindow = %v, want 5m", got)
+	}
+	if got := table.For(Free).MaxChirpLength; got != Defaults()[Free].MaxChirpLength {
+		t.Errorf("Free MaxChirpLength = %d, want the default", got)
+	}
+	if got := table.For("gold"); got != table.For(Free) {
+		t.Errorf("Expected an unknown plan to get the free limits, got %+v", got)
+	}
+	if got := table.Max().ChirpsPerHour; got != 0 {
+		t.Errorf("Max ChirpsPerHour = %d, want 0 (unlimited)", got)
+	}
+
+	for _, bad := range []map[string]string{
+		{"FREE_MAX_CHIRP_LENGTH": "0"},
+		{"RED_MAX_ATTACHMENTS": "lots"},
+		{"RED_EDIT_WINDOW": "-1m"},
+		{"FREE_SCHEDULED_POSTING": "sometimes"},
+	} {
+		if _, err := FromEnv(func(key string) string { return bad[key] }); err == nil {
+			t.Errorf("Expected an error for %v", bad)
+		}
+	}
+}
+
+type fixedPlan Plan
+
+func (p fixedPlan) UserPlan(ctx context.Context, userID uuid.UUID) (Plan, error) {
+	return Plan(p), nil
+}
+
+func TestServiceLimits(t *testing.T) {
+	s := New(Defaults(), fixedPlan(Red))
+	limits, err := s.Limits(context.Background(), uuid.New())
+	if err != nil {
+		t.Fatalf("Limits failed: %v", err)
+	}
+	if limits != Defaults()[Red] {
+		t.Errorf("Limits = %+v, want the red limits", limits)
+	}
+	if got := s.Max().MaxChirpLength; got != Defaults()[Red].MaxChirpLength {
+		t.Errorf("Max MaxChirpLength = %d, want %d", got, Defaults()[Red].MaxChirpLength)
+	}
+}
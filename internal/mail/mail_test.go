@@ -0,0 +1,87 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatMessage(t *testing.T) {
+	date := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg := Message{
+		To:      "user@example.com",
+		Subject: "Verify your email",
+		Body:    "Hi!\nhttps://chirpy.example.com/verify-email?token=abc123\n",
+	}
+	data, err := formatMessage("Chirpy <no-reply@example.com>", msg, date)
+	if err != nil {
+		t.Fatalf("formatMessage: %v", err)
+	}
+
+	header, body, ok := strings.Cut(string(data), "\r\n\r\n")
+	if !ok {
+		t.Fatalf("No header/body separator in %q", data)
+	}
+	for _, want := range []string{
+		"From: Chirpy <no-reply@example.com>",
+		"To: user@example.com",
+		"Subject: Verify your email",
+		"Date: Thu, 02 Jan 2025 03:04:05 +0000",
+		"Content-Type: text/plain; charset=utf-8",
+	} {
+		if !strings.Contains(header, want+"\r\n") {
+			t.Errorf("Header missing %q:\n%s", want, header)
+		}
+	}
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(decoded), strings.ReplaceAll(msg.Body, "\n", "\r\n"); got != want {
+		t.Errorf("Body = %q, want %q", got, want)
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	msgs := []Message{
+		{To: "user@example.com\r\nBcc: everyone@example.com", Subject: "Hi"},
+		{To: "user@example.com", Subject: "Hi\nBcc: everyone@example.com"},
+	}
+	for _, msg := range msgs {
+		if _, err := formatMessage("no-reply@example.com", msg, time.Now()); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("formatMessage(%q): got %v, want ErrInvalidHeader", msg, err)
+		}
+		if err := NewLogMailer(io.Discard).Send(context.Background(), msg); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("LogMailer.Send(%q): got %v, want ErrInvalidHeader", msg, err)
+		}
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer(&buf)
+	err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "Reset", Body: "token=a=b"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := buf.String(); !strings.Contains(got, "To: user@example.com\n") || !strings.Contains(got, "token=a=b") {
+		t.Errorf("Unexpected output %q", got)
+	}
+}
+
+func TestEnvelopeAddress(t *testing.T) {
+	cases := map[string]string{
+		"Chirpy <no-reply@example.com>": "no-reply@example.com",
+		"no-reply@example.com":          "no-reply@example.com",
+	}
+	for in, want := range cases {
+		if got := envelopeAddress(in); got != want {
+			t.Errorf("envelopeAddress(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// MaxPixels bounds the decoded size of an upload so a small, highly
+	// compressed file can't exhaust memory.
+	MaxPixels = 40_000_000
+
+	ThumbnailSize = 320
+	jpegQuality   = 90
+)
+
+var ErrUnsupportedType = errors.New("unsupported image type")
+
+// Image is an encoded image ready to be stored.
+type Image struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+}
+
+// Process validates an uploaded image and re-encodes it, which drops any EXIF
+// or other metadata the original carried. It also returns a thumbnail that
+// fits within ThumbnailSize on both sides.
+func Process(data []byte) (Image, Image, error) {
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return Image{}, Image{}, ErrUnsupportedType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, Image{}, fmt.Errorf("reading image: %w", err)
+	}
+	if config.Width < 1 || config.Height < 1 || config.Width*config.Height > MaxPixels {
+		return Image{}, Image{}, fmt.Errorf("image dimensions %dx%d not allowed", config.Width, config.Height)
+	}
+
+	src, err := decode(contentType, data)
+	if err != nil {
+		return Image{}, Image{}, fmt.Errorf("decoding image: %w", err)
+	}
+
+	full, err := encode(contentType, src)
+	if err != nil {
+		return Image{}, Image{}, err
+	}
+	thumb, err := encode(contentType, Thumbnail(src, ThumbnailSize))
+	if err != nil {
+		return Image{}, Image{}, err
+	}
+	return full, thumb, nil
+}
+
+func decode(contentType string, data []byte) (image.Image, error) {
+	r := bytes.NewReader(data)
+	switch contentType {
+	case "image/jpeg":
+		return jpeg.Decode(r)
+	case "image/png":
+		return png.Decode(r)
+	default:
+		// Only the first frame of an animated GIF is kept.
+		return gif.Decode(r)
+	}
+}
+
+// encode writes JPEGs back as JPEG and everything else as PNG so that
+// transparency survives.
+func encode(contentType string, img image.Image) (Image, error) {
+	var buf bytes.Buffer
+	out := Image{
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}
+	if contentType == "image/jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return Image{}, fmt.Errorf("encoding image: %w", err)
+		}
+		out.ContentType, out.Extension = "image/jpeg", ".jpg"
+	} else {
+		if err := png.Encode(&buf, img); err != nil {
+			return Image{}, fmt.Errorf("encoding image: %w", err)
+		}
+		out.ContentType, out.Extension = "image/png", ".png"
+	}
+	out.Data = buf.Bytes()
+	return out, nil
+}
+
+// Thumbnail scales img down, keeping its aspect ratio, so that neither side is
+// larger than size. Each output pixel is the average of the source pixels it
+// covers. Images that already fit are returned unchanged.
+func Thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+
+	tw, th := size, size
+	if w > h {
+		th = max(1, h*size/w)
+	} else {
+		tw = max(1, w*size/h)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	// Source rows are converted to RGBA one band at a time, only as many as
+	// make up an output row, rather than copying the whole image.
+	band := image.NewRGBA(image.Rect(0, 0, w, (h+th-1)/th+1))
+
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, max((y+1)*h/th, y*h/th+1)
+		draw.Draw(band, image.Rect(0, 0, w, y1-y0), img, image.Pt(b.Min.X, b.Min.Y+y0), draw.Src)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, a, n uint64
+			for sy := 0; sy < y1-y0; sy++ {
+				row := band.Pix[sy*band.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					bl += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(bl/n), uint8(a/n)
+		}
+	}
+	return dst
+}
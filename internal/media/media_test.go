@@ -0,0 +1,77 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 500))
+	thumb := Thumbnail(img, 320)
+	if thumb.Bounds().Dx() != 320 || thumb.Bounds().Dy() != 160 {
+		t.Errorf("Thumbnail size = %v, want 320x160", thumb.Bounds().Size())
+	}
+
+	small := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	if Thumbnail(small, 320) != image.Image(small) {
+		t.Errorf("Expected an image that already fits to be returned unchanged")
+	}
+}
+
+func TestThumbnailAverages(t *testing.T) {
+	// Alternating black and white columns, in an image whose bounds don't
+	// start at the origin, average out to grey.
+	img := image.NewGray(image.Rect(10, 20, 1010, 520))
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x += 2 {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	thumb := Thumbnail(img, 100)
+	if thumb.Bounds().Dx() != 100 || thumb.Bounds().Dy() != 50 {
+		t.Fatalf("Thumbnail size = %v, want 100x50", thumb.Bounds().Size())
+	}
+	for _, p := range []image.Point{{0, 0}, {50, 25}, {99, 49}} {
+		r, g, b, a := thumb.At(p.X, p.Y).RGBA()
+		if r>>8 != 127 || g>>8 != 127 || b>>8 != 127 || a>>8 != 255 {
+			t.Errorf("Pixel %v = %d,%d,%d,%d, want grey", p, r>>8, g>>8, b>>8, a>>8)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for y := 0; y < 480; y++ {
+		for x := 0; x < 640; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Splice an APP1 (EXIF) segment in after the SOI marker.
+	exif := []byte{0xFF, 0xE1, 0x00, 0x0C, 'E', 'x', 'i', 'f', 0, 0, 'G', 'P', 'S', '!'}
+	data := append([]byte{0xFF, 0xD8}, append(exif, buf.Bytes()[2:]...)...)
+
+	full, thumb, err := Process(data)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if full.Width != 640 || full.Height != 480 || full.ContentType != "image/jpeg" {
+		t.Errorf("Unexpected image: %dx%d %s", full.Width, full.Height, full.ContentType)
+	}
+	if thumb.Width != 320 || thumb.Height != 240 {
+		t.Errorf("Unexpected thumbnail size: %dx%d", thumb.Width, thumb.Height)
+	}
+	if bytes.Contains(full.Data, []byte("Exif")) {
+		t.Errorf("Expected EXIF data to be stripped")
+	}
+
+	if _, _, err := Process([]byte("not an image")); err != ErrUnsupportedType {
+		t.Errorf("Expected ErrUnsupportedType, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Backoff tracks consecutive failures for each key, such as failed logins.
+// After a number of free failures, each one doubles how long the key has to
+// wait before trying again, up to a maximum that acts as a temporary
+// lockout. Like Limiter, state is kept in memory.
+type Backoff struct {
+	free int
+	base time.Duration
+	max  time.Duration
+	now  func() time.Time
+
+	mu        sync.Mutex
+	failures  map[string]*failures
+	lastSweep time.Time
+}
+
+type failures struct {
+	count int
+	until time.Time
+}
+
+// NewBackoff returns a Backoff that allows free failures, then makes a key
+// wait base, doubling with each further failure up to max. A key's failures
+// are forgotten once it has gone max past its wait without failing again.
+func NewBackoff(free int, base, max time.Duration) *Backoff {
+	return &Backoff{
+		free:     free,
+		base:     base,
+		max:      max,
+		now:      time.Now,
+		failures: make(map[string]*failures),
+	}
+}
+
+// Wait reports how long key must wait before its next attempt, or zero if
+// it can try now.
+func (b *Backoff) Wait(key string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	f := b.get(key, now)
+	if f == nil || !now.Before(f.until) {
+		return 0
+	}
+	return f.until.Sub(now)
+}
+
+// Fail records a failed attempt for key, returning how long it must now
+// wait.
+func (b *Backoff) Fail(key string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.sweep(now)
+	f := b.get(key, now)
+	if f == nil {
+		f = &failures{}
+		b.failures[key] = f
+	}
+	f.count++
+	wait := b.delay(f.count)
+	f.until = now.Add(wait)
+	return wait
+}
+
+// Reset forgets key's failures, e.g. after a successful attempt.
+func (b *Backoff) Reset(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.failures, key)
+}
+
+func (b *Backoff) delay(count int) time.Duration {
+	if count <= b.free {
+		return 0
+	}
+	wait := b.base
+	for i := b.free + 1; i < count && wait < b.max; i++ {
+		wait *= 2
+	}
+	return min(wait, b.max)
+}
+
+// get returns key's failures, dropping them if they've expired.
+func (b *Backoff) get(key string, now time.Time) *failures {
+	f, ok := b.failures[key]
+	if !ok {
+		return nil
+	}
+	if b.expired(f, now) {
+		delete(b.failures, key)
+		return nil
+	}
+	return f
+}
+
+func (b *Backoff) expired(f *failures, now time.Time) bool {
+	return now.Sub(f.until) >= b.max
+}
+
+// sweep drops expired failures so keys that stop trying don't pile up.
+func (b *Backoff) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < b.max {
+		return
+	}
+	for key, f := range b.failures {
+		if b.expired(f, now) {
+			delete(b.failures, key)
+		}
+	}
+	b.lastSweep = now
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBackoff(3, time.Second, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if wait := b.Fail("a"); wait != 0 {
+			t.Fatalf("Failure %d: wait = %v, want 0", i+1, wait)
+		}
+	}
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if wait := b.Fail("a"); wait != want {
+			t.Errorf("wait = %v, want %v", wait, want)
+		}
+	}
+	if wait := b.Wait("a"); wait != 10*time.Second {
+		t.Errorf("Wait = %v, want 10s", wait)
+	}
+	if wait := b.Wait("b"); wait != 0 {
+		t.Errorf("Expected a different key not to wait, got %v", wait)
+	}
+
+	now = now.Add(4 * time.Second)
+	if wait := b.Wait("a"); wait != 6*time.Second {
+		t.Errorf("Wait = %v, want 6s", wait)
+	}
+
+	// Still locked out until the wait is over, then still counting
+	// failures until max has passed.
+	now = now.Add(6 * time.Second)
+	if wait := b.Wait("a"); wait != 0 {
+		t.Errorf("Wait = %v, want 0", wait)
+	}
+	if wait := b.Fail("a"); wait != 10*time.Second {
+		t.Errorf("wait = %v, want 10s", wait)
+	}
+
+	now = now.Add(20 * time.Second)
+	if wait := b.Fail("a"); wait != 0 {
+		t.Errorf("Expected failures to be forgotten, got wait %v", wait)
+	}
+}
+
+func TestBackoffReset(t *testing.T) {
+	b := NewBackoff(0, time.Minute, time.Hour)
+	if wait := b.Fail("a"); wait != time.Minute {
+		t.Fatalf("wait = %v, want 1m", wait)
+	}
+	b.Reset("a")
+	if wait := b.Wait("a"); wait != 0 {
+		t.Errorf("Wait after Reset = %v, want 0", wait)
+	}
+	if wait := b.Fail("a"); wait != time.Minute {
+		t.Errorf("Expected the count to restart, got wait %v", wait)
+	}
+}
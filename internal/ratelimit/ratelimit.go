@@ -0,0 +1,76 @@
+// Package ratelimit has in-memory limiters keyed by string: a token bucket
+// for rates and an exponential backoff for repeated failures.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows up to limit events per window for each key, refilling
+// continuously. State is kept in memory, so each server instance limits
+// independently.
+type Limiter struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func New(window time.Duration) *Limiter {
+	return &Limiter{
+		window:  window,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow records an event for key if it's within limit, and otherwise reports
+// how long to wait before trying again. A limit of zero or less means no
+// limit.
+func (l *Limiter) Allow(key string, limit int) (bool, time.Duration) {
+	if limit <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit), updated: now}
+		l.buckets[key] = b
+	}
+	refilled := float64(now.Sub(b.updated)) * float64(limit) / float64(l.window)
+	b.tokens = min(float64(limit), b.tokens+refilled)
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) * float64(l.window) / float64(limit))
+}
+
+// sweep drops buckets that have been idle for a whole window, since they're
+// full again and no different from a missing one.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.window {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,36 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(time.Hour)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a", 3); !ok {
+			t.Fatalf("Expected event %d to be allowed", i+1)
+		}
+	}
+	ok, retryAfter := l.Allow("a", 3)
+	if ok {
+		t.Fatalf("Expected the fourth event to be limited")
+	}
+	if retryAfter != 20*time.Minute {
+		t.Errorf("retryAfter = %v, want 20m", retryAfter)
+	}
+	if ok, _ := l.Allow("b", 3); !ok {
+		t.Errorf("Expected a different key to have its own limit")
+	}
+
+	now = now.Add(20 * time.Minute)
+	if ok, _ := l.Allow("a", 3); !ok {
+		t.Errorf("Expected a token to have refilled")
+	}
+	if ok, _ := l.Allow("a", 0); !ok {
+		t.Errorf("Expected a zero limit to mean no limit")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/JoStMc/Chirpy/internal/auth"
+)
+
+// loadJWTKeys loads the keys access tokens are signed and verified with from
+// JWT_KEYS_DIR, signing with JWT_ACTIVE_KID. Without a directory, a key is
+// generated that only lasts as long as the server, but only on the dev
+// platform; anywhere else that would log everyone out on every restart.
+func loadJWTKeys(platform string) (*auth.KeySet, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		if platform != "dev" {
+			return nil, errors.New("JWT_KEYS_DIR must be set unless PLATFORM=dev")
+		} 
+		log.Println("Warning: JWT_KEYS_DIR is not set, so access tokens are signed with a temporary key and won't survive a restart")
+		return auth.GenerateKeySet()
+	} 
+	keys, err := auth.LoadKeySet(dir, os.Getenv("JWT_ACTIVE_KID"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load JWT keys: %w", err)
+	} 
+	return keys, nil
+} 
+
+// handlerJWKS publishes the public keys access tokens can be verified with,
+// so other services don't need to call us to check a token.
+func (cfg *apiConfig) handlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.jwtKeys.JWKS())
+} 
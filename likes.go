@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerLikeChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprint(err))
+		return
+	} 
+	userID, err := cfg.scopedUserID(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithError(w, authErrorStatus(err), fmt.Sprint(err))
+		return
+	} 
+
+	ctx := r.Context()
+	chirp, err := cfg.dbQueries.GetChirp(ctx, chirpID)
+	if err != nil || chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	} 
+
+	liked, err := cfg.dbQueries.LikeChirp(ctx, database.LikeChirpParams{
+		UserID: userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error liking chirp: %v", err))
+		return
+	} 
+	if liked > 0 {
+		cfg.notifyBestEffort(ctx, chirp.UserID, userID, notificationLike, uuid.NullUUID{UUID: chirpID, Valid: true})
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
+
+func (cfg *apiConfig) handlerUnlikeChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprint(err))
+		return
+	} 
+	userID, err := cfg.scopedUserID(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithError(w, authErrorStatus(err), fmt.Sprint(err))
+		return
+	} 
+
+	_, err = cfg.dbQueries.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		UserID: userID,
+		ChirpID: chirpID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error unliking chirp: %v", err))
+		return
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
+
+func (cfg *apiConfig) handlerGetUserLikes(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	} 
+	p, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	} 
+
+	rows, err := cfg.dbQueries.ListLikedChirps(r.Context(), database.ListLikedChirpsParams{
+		UserID: userID,
+		AfterCreatedAt: p.afterCreatedAt(),
+		AfterID: p.afterID(),
+		Limit: p.queryLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving likes: %v", err))
+		return
+	} 
+
+	n := setNextLink(w, r, p, len(rows), func(i int) cursor {
+		return cursor{CreatedAt: rows[i].LikedAt, ID: rows[i].Chirp.ID}
+	})
+	chirps := make([]Chirp, n)
+	for i, row := range rows[:n] {
+		chirps[i] = chirpFromDB(row.Chirp)
+	} 
+	if err := cfg.populateChirps(r, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving likes: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, chirps)
+} 
+
+// setLikedByMe marks which of the chirps the viewer has liked.
+func (cfg *apiConfig) setLikedByMe(ctx context.Context, viewerID uuid.UUID, chirps []Chirp) error {
+	ids := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		ids[i] = c.ID
+	} 
+	liked, err := cfg.dbQueries.GetLikedChirpIDs(ctx, database.GetLikedChirpIDsParams{
+		UserID: viewerID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	} 
+
+	likedSet := make(map[uuid.UUID]bool, len(liked))
+	for _, id := range liked {
+		likedSet[id] = true
+	} 
+	for i := range chirps {
+		likedByMe := likedSet[chirps[i].ID]
+		chirps[i].LikedByMe = &likedByMe
+	} 
+	return nil
+} 
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/ratelimit"
+)
+
+const (
+	// After a few free failures, each failed login doubles the wait before
+	// the next attempt, from a second up to a lockout of 15 minutes. IPs get
+	// more, since many users can share one.
+	freeAccountLoginFailures = 5
+	freeIPLoginFailures = 20
+	loginBackoffBase = time.Second
+	loginLockout = 15 * time.Minute
+)
+
+// loginThrottle slows down password guessing, both against one account and
+// from one IP. Accounts are tracked by email whether or not they exist, so
+// throttling doesn't give away which do.
+type loginThrottle struct {
+	accounts *ratelimit.Backoff
+	ips *ratelimit.Backoff
+} 
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{
+		accounts: ratelimit.NewBackoff(freeAccountLoginFailures, loginBackoffBase, loginLockout),
+		ips: ratelimit.NewBackoff(freeIPLoginFailures, loginBackoffBase, loginLockout),
+	} 
+} 
+
+// wait is how long a login for email from ip must wait.
+func (t *loginThrottle) wait(email, ip string) time.Duration {
+	return max(t.accounts.Wait(strings.ToLower(email)), t.ips.Wait(ip))
+} 
+
+func (t *loginThrottle) fail(email, ip string) {
+	t.accounts.Fail(strings.ToLower(email))
+	t.ips.Fail(ip)
+} 
+
+// succeed resets the account's failures. The IP's are kept, so an attacker
+// can't clear them by logging in to an account of their own.
+func (t *loginThrottle) succeed(email string) {
+	t.accounts.Reset(strings.ToLower(email))
+} 
+
+func respondWithLoginThrottled(w http.ResponseWriter, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, fmt.Sprintf("Too many failed login attempts, try again in %d seconds", seconds))
+} 
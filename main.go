@@ -1,22 +1,49 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync/atomic"
+	"time"
 
+	"github.com/JoStMc/Chirpy/internal/auth"
 	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/JoStMc/Chirpy/internal/entitlements"
+	"github.com/JoStMc/Chirpy/internal/mail"
+	"github.com/JoStMc/Chirpy/internal/ratelimit"
+	"github.com/JoStMc/Chirpy/internal/storage"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	jwtSecret string
+	jwtKeys *auth.KeySet
+	passwordParams auth.PasswordParams
+	passwordPolicy auth.PasswordPolicy
 	polkaKey string
+	polkaSecrets []string
+	polkaTolerance time.Duration
+	rejectedWebhookLimiter *ratelimit.Limiter
+	db *sql.DB
 	dbQueries *database.Queries
 	fileserverHits atomic.Int32
+	blobStore storage.BlobStore
+	entitlements entitlements.Checker
+	chirpLimiter *ratelimit.Limiter
+	loginThrottle *loginThrottle
+	mailer mail.Mailer
+	mailLimiter *ratelimit.Limiter
+	unverifiedPolicy unverifiedPolicy
+	// appURL is where links in emails point.
+	appURL string
+	// platform is "dev" on development machines, where the database can
+	// be reset.
+	platform string
 } 
 
 func main() {
@@ -28,12 +55,90 @@ func main() {
 		log.Fatal("unable to open db:", err)
 	} 
 
+	plans, err := entitlements.FromEnv(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	} 
+	polkaTolerance, err := durationFromEnv("POLKA_WEBHOOK_TOLERANCE", 5 * time.Minute)
+	if err != nil {
+		log.Fatal(err)
+	} 
+	polkaSecrets := splitList(os.Getenv("POLKA_WEBHOOK_SECRETS"))
+	if len(polkaSecrets) == 0 {
+		log.Println("Warning: POLKA_WEBHOOK_SECRETS is not set, so Polka webhooks are only checked against POLKA_KEY")
+	} 
+	subscriptionSweepInterval, err := durationFromEnv("SUBSCRIPTION_SWEEP_INTERVAL", 10 * time.Minute)
+	if err != nil {
+		log.Fatal(err)
+	} 
+	scheduledChirpsInterval, err := durationFromEnv("SCHEDULED_CHIRPS_INTERVAL", 30 * time.Second)
+	if err != nil {
+		log.Fatal(err)
+	} 
+
+	platform := os.Getenv("PLATFORM")
+	jwtKeys, err := loadJWTKeys(platform)
+	if err != nil {
+		log.Fatal(err)
+	} 
+	passwordParams, err := auth.PasswordParamsFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	} 
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Fatal(err)
+	} 
+
+	mailer, err := loadMailer()
+	if err != nil {
+		log.Fatal(err)
+	} 
+	policy, err := unverifiedPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	} 
+	// Links in emails go to the frontend, which POSTs their token to the API.
+	appURL := strings.TrimSuffix(os.Getenv("APP_URL"), "/")
+	if appURL == "" {
+		if platform != "dev" {
+			log.Fatal("APP_URL must be set unless PLATFORM=dev")
+		} 
+		appURL = "http://localhost:8080"
+	} 
+
+	blobStore, err := storage.NewLocalStore("uploads", "/app/uploads")
+	if err != nil {
+		log.Fatal(err)
+	} 
+
 	cfg := apiConfig{
-		jwtSecret: os.Getenv("TOKEN_SECRET"),
+		jwtKeys: jwtKeys,
+		passwordParams: passwordParams,
+		passwordPolicy: passwordPolicy,
 		polkaKey: os.Getenv("POLKA_KEY"),
+		polkaSecrets: polkaSecrets,
+		polkaTolerance: polkaTolerance,
+		rejectedWebhookLimiter: ratelimit.New(time.Hour),
+		db: db,
 		dbQueries: database.New(db),
 		fileserverHits: atomic.Int32{},
+		blobStore: blobStore,
+		chirpLimiter: ratelimit.New(time.Hour),
+		loginThrottle: newLoginThrottle(),
+		mailer: mailer,
+		mailLimiter: ratelimit.New(time.Hour),
+		unverifiedPolicy: policy,
+		appURL: appURL,
+		platform: platform,
 	}
+	cfg.entitlements = entitlements.New(plans, dbPlanSource{cfg.dbQueries})
+	if err := cfg.bootstrapAdmin(context.Background()); err != nil {
+		log.Fatal(err)
+	} 
+
+	go cfg.publishScheduledChirps(scheduledChirpsInterval)
+	go cfg.expireSubscriptions(subscriptionSweepInterval)
 
 	mux := http.NewServeMux()
 	cfg.registerHandlers(mux)
@@ -52,21 +157,90 @@ func (cfg *apiConfig) registerHandlers(mux *http.ServeMux) {
 	mux.Handle("/app/", http.StripPrefix("/app", cfg.middlewareMetricsInc(http.FileServer(http.Dir(".")))))
 
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.handlerJWKS)
 
 	mux.HandleFunc("POST /api/chirps", cfg.handlerCreateChirp)
 	mux.HandleFunc("GET /api/chirps", cfg.handlerGetAllChirps)
+	mux.HandleFunc("GET /api/chirps/search", cfg.handlerSearchChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handlerGetChirp)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", cfg.handlerUpdateChirp)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.handlerDeleteChirp)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/history", cfg.handlerGetChirpHistory)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/replies", cfg.handlerGetReplies)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/like", cfg.handlerLikeChirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/like", cfg.handlerUnlikeChirp)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirp", cfg.handlerRechirp)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/rechirp", cfg.handlerUndoRechirp)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerCreateUser)
 	mux.HandleFunc("PUT /api/users", cfg.handlerUpdateUser)
+	mux.HandleFunc("GET /api/users/{handleOrID}", cfg.handlerGetProfile)
+	mux.HandleFunc("GET /api/users/{userID}/likes", cfg.handlerGetUserLikes)
+	mux.HandleFunc("POST /api/users/{userID}/follow", cfg.handlerFollowUser)
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", cfg.handlerUnfollowUser)
+	mux.HandleFunc("POST /api/users/verify-email/request", cfg.handlerRequestEmailVerification)
+	mux.HandleFunc("POST /api/users/verify-email", cfg.handlerVerifyEmail)
+	mux.HandleFunc("POST /api/password-reset/request", cfg.handlerRequestPasswordReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", cfg.handlerConfirmPasswordReset)
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
+	mux.HandleFunc("POST /api/login/2fa", cfg.handlerLoginTwoFactor)
+
+	mux.HandleFunc("POST /api/2fa/setup", cfg.handlerSetupTwoFactor)
+	mux.HandleFunc("POST /api/2fa/verify", cfg.handlerVerifyTwoFactor)
+	mux.HandleFunc("DELETE /api/2fa", cfg.handlerDisableTwoFactor)
+
+	mux.HandleFunc("GET /api/timeline", cfg.handlerTimeline)
+
+	mux.HandleFunc("GET /api/schedule", cfg.handlerGetScheduledChirps)
+	mux.HandleFunc("DELETE /api/schedule/{scheduledID}", cfg.handlerCancelScheduledChirp)
+
+	mux.HandleFunc("GET /api/notifications", cfg.handlerGetNotifications)
+	mux.HandleFunc("POST /api/notifications/read", cfg.handlerMarkNotificationsRead)
+
+	mux.HandleFunc("GET /api/tags/trending", cfg.handlerTrendingTags)
+	mux.HandleFunc("GET /api/tags/{tag}/chirps", cfg.handlerGetTagChirps)
 
-	mux.HandleFunc("POST /api/polka/webhooks", cfg.handlerUpgradeUser)
+	mux.HandleFunc("POST /api/polka/webhooks", cfg.handlerPolkaWebhook)
 
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
 
-	mux.HandleFunc("GET /admin/metrics", cfg.handlerMetrics)
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.HandleFunc("POST /api/keys", cfg.handlerCreateAPIKey)
+	mux.HandleFunc("GET /api/keys", cfg.handlerGetAPIKeys)
+	mux.HandleFunc("DELETE /api/keys/{keyID}", cfg.handlerRevokeAPIKey)
+
+	mux.HandleFunc("GET /api/sessions", cfg.handlerGetSessions)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.handlerRevokeSession)
+	mux.HandleFunc("POST /api/sessions/revoke-all", cfg.handlerRevokeAllSessions)
+
+	mux.Handle("GET /admin/metrics", cfg.middlewareRequireRole(roleAdmin, cfg.handlerMetrics))
+	mux.Handle("POST /admin/reset", cfg.middlewareRequireRole(roleAdmin, cfg.handlerReset))
+	mux.Handle("GET /admin/webhooks", cfg.middlewareRequireRole(roleAdmin, cfg.handlerGetWebhookDeliveries))
+	mux.Handle("POST /admin/webhooks/{deliveryID}/replay", cfg.middlewareRequireRole(roleAdmin, cfg.handlerReplayWebhookDelivery))
 }
+
+// durationFromEnv reads a time.ParseDuration string such as "15m" from the
+// environment, falling back to def when the variable is unset.
+func durationFromEnv(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	} 
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	} 
+	return d, nil
+} 
+
+// splitList splits a comma separated environment variable, dropping empty
+// entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		} 
+	} 
+	return items
+} 
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// A mention is an @ at the start of a word followed by a handle, so email
+// addresses like a@b.com don't count.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([A-Za-z0-9_]{3,30})\b`)
+
+// extractMentions returns the distinct handles mentioned in a chirp body,
+// lowercased.
+func extractMentions(body string) []string {
+	var handles []string
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		handle := strings.ToLower(match[1])
+		if !seen[handle] {
+			seen[handle] = true
+			handles = append(handles, handle)
+		} 
+	} 
+	return handles
+} 
+
+// resolveMentions looks up the users mentioned in a chirp body. Handles that
+// don't belong to anyone are ignored.
+func (cfg *apiConfig) resolveMentions(ctx context.Context, body string) ([]uuid.UUID, error) {
+	handles := extractMentions(body)
+	if len(handles) == 0 {
+		return nil, nil
+	} 
+	users, err := cfg.dbQueries.GetUsersByHandles(ctx, handles)
+	if err != nil {
+		return nil, err
+	} 
+	ids := make([]uuid.UUID, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	} 
+	return ids, nil
+} 
+
+// replaceMentions records the mentions of an edited chirp, notifying only the
+// users who weren't already mentioned before the edit.
+func replaceMentions(ctx context.Context, qtx *database.Queries, chirp database.Chirp, mentions []uuid.UUID) error {
+	previous, err := qtx.GetChirpMentions(ctx, []uuid.UUID{chirp.ID})
+	if err != nil {
+		return err
+	} 
+	alreadyMentioned := make(map[uuid.UUID]bool, len(previous))
+	for _, m := range previous {
+		alreadyMentioned[m.UserID] = true
+	} 
+
+	if err := qtx.DeleteChirpMentions(ctx, chirp.ID); err != nil {
+		return err
+	} 
+	if len(mentions) == 0 {
+		return nil
+	} 
+	err = qtx.CreateChirpMentions(ctx, database.CreateChirpMentionsParams{
+		ChirpID: chirp.ID,
+		UserIds: mentions,
+	})
+	if err != nil {
+		return err
+	} 
+
+	chirpID := uuid.NullUUID{UUID: chirp.ID, Valid: true}
+	for _, userID := range mentions {
+		if alreadyMentioned[userID] {
+			continue
+		} 
+		if err := notify(ctx, qtx, userID, chirp.UserID, notificationMention, chirpID); err != nil {
+			return err
+		} 
+	} 
+	return nil
+} 
+
+// setMentions loads the IDs of the users each chirp mentions.
+func (cfg *apiConfig) setMentions(ctx context.Context, chirps []Chirp) error {
+	ids := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		ids[i] = c.ID
+	} 
+	mentions, err := cfg.dbQueries.GetChirpMentions(ctx, ids)
+	if err != nil {
+		return err
+	} 
+
+	byChirp := make(map[uuid.UUID][]uuid.UUID)
+	for _, m := range mentions {
+		byChirp[m.ChirpID] = append(byChirp[m.ChirpID], m.UserID)
+	} 
+	for i := range chirps {
+		chirps[i].Mentions = byChirp[chirps[i].ID]
+	} 
+	return nil
+} 
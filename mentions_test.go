@@ -0,0 +1,31 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	cases := []struct {
+		body string
+		want []string
+	}{
+		{"", nil},
+		{"hello", nil},
+		{"@alice", []string{"alice"}},
+		{"hi @Alice and @bob_99!", []string{"alice", "bob_99"}},
+		{"@alice @ALICE @Alice", []string{"alice"}},
+		{"(@alice), @bob.", []string{"alice", "bob"}},
+		// Email addresses aren't mentions.
+		{"write to a@example.com", nil},
+		{"@@alice", nil},
+		// Handles are 3 to 30 characters.
+		{"@ab", nil},
+		{"@abcdefghijabcdefghijabcdefghijk", nil},
+	}
+	for _, c := range cases {
+		if got := extractMentions(c.body); !slices.Equal(got, c.want) {
+			t.Errorf("extractMentions(%q) = %q, want %q", c.body, got, c.want)
+		}
+	}
+}
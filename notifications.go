@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	notificationMention = "mention"
+	notificationReply   = "reply"
+	notificationLike    = "like"
+	notificationFollow  = "follow"
+	notificationRechirp = "rechirp"
+	notificationQuote   = "quote"
+)
+
+type Notification struct {
+	ID        uuid.UUID  `json:"id"`
+	Kind      string     `json:"kind"`
+	ActorID   uuid.UUID  `json:"actor_id"`
+	ChirpID   *uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Read      bool       `json:"read"`
+} 
+
+type notificationsResponse struct {
+	UnreadCount   int64          `json:"unread_count"`
+	Notifications []Notification `json:"notifications"`
+} 
+
+type markNotificationsReadRequest struct {
+	IDs []uuid.UUID `json:"ids"`
+} 
+
+// notify records a notification for recipient. Users are never notified
+// about their own actions.
+func notify(ctx context.Context, q *database.Queries, recipient, actor uuid.UUID, kind string, chirpID uuid.NullUUID) error {
+	if recipient == actor {
+		return nil
+	} 
+	return q.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID: recipient,
+		ActorID: actor,
+		Kind: kind,
+		ChirpID: chirpID,
+	})
+} 
+
+// notifyBestEffort is for actions that have already been committed, where a
+// failed notification shouldn't fail the request.
+func (cfg *apiConfig) notifyBestEffort(ctx context.Context, recipient, actor uuid.UUID, kind string, chirpID uuid.NullUUID) {
+	if err := notify(ctx, cfg.dbQueries, recipient, actor, kind, chirpID); err != nil {
+		log.Printf("Error creating %s notification: %v", kind, err)
+	} 
+} 
+
+func (cfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+	p, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	} 
+
+	ctx := r.Context()
+	notifications, err := cfg.dbQueries.ListNotifications(ctx, database.ListNotificationsParams{
+		UserID: userID,
+		UnreadOnly: r.URL.Query().Get("unread") == "true",
+		AfterCreatedAt: p.afterCreatedAt(),
+		AfterID: p.afterID(),
+		Limit: p.queryLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving notifications: %v", err))
+		return
+	} 
+	unread, err := cfg.dbQueries.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error counting notifications: %v", err))
+		return
+	} 
+
+	n := setNextLink(w, r, p, len(notifications), func(i int) cursor {
+		return cursor{CreatedAt: notifications[i].CreatedAt, ID: notifications[i].ID}
+	})
+	response := notificationsResponse{
+		UnreadCount: unread,
+		Notifications: make([]Notification, n),
+	} 
+	for i, dbNotification := range notifications[:n] {
+		notification := Notification{
+			ID: dbNotification.ID,
+			Kind: dbNotification.Kind,
+			ActorID: dbNotification.ActorID,
+			CreatedAt: dbNotification.CreatedAt,
+			Read: dbNotification.ReadAt.Valid,
+		} 
+		if dbNotification.ChirpID.Valid {
+			notification.ChirpID = &dbNotification.ChirpID.UUID
+		} 
+		response.Notifications[i] = notification
+	} 
+	respondWithJSON(w, http.StatusOK, response)
+} 
+
+// handlerMarkNotificationsRead marks the given notifications as read, or all
+// of them if no IDs are given.
+func (cfg *apiConfig) handlerMarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+
+	var params markNotificationsReadRequest
+	if r.ContentLength != 0 {
+		params, err = decodeJSON[markNotificationsReadRequest](r)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
+			return
+		} 
+	} 
+
+	ctx := r.Context()
+	if len(params.IDs) == 0 {
+		_, err = cfg.dbQueries.MarkAllNotificationsRead(ctx, userID)
+	} else {
+		_, err = cfg.dbQueries.MarkNotificationsRead(ctx, database.MarkNotificationsReadParams{
+			UserID: userID,
+			Ids: params.IDs,
+		})
+	} 
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error updating notifications: %v", err))
+		return
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
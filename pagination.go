@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// cursor marks the last item of a page so the next page can resume after it.
+// Clients only ever see it as an opaque string.
+type cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (c cursor) encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, errors.New("invalid cursor")
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return cursor{}, errors.New("invalid cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return cursor{}, errors.New("invalid cursor")
+	}
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return cursor{}, errors.New("invalid cursor")
+	}
+	return cursor{CreatedAt: t, ID: parsedID}, nil
+}
+
+type page struct {
+	Limit int32
+	After *cursor
+}
+
+// afterCreatedAt and afterID are the nullable keyset arguments the list
+// queries take.
+func (p page) afterCreatedAt() sql.NullTime {
+	if p.After == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: p.After.CreatedAt, Valid: true}
+}
+
+func (p page) afterID() uuid.NullUUID {
+	if p.After == nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: p.After.ID, Valid: true}
+}
+
+// queryLimit asks for one extra row so we know whether a next page exists.
+func (p page) queryLimit() int32 {
+	return p.Limit + 1
+}
+
+func parsePage(r *http.Request) (page, error) {
+	p := page{Limit: defaultPageLimit}
+	query := r.URL.Query()
+
+	if limitString := query.Get("limit"); limitString != "" {
+		limit, err := strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return page{}, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		p.Limit = int32(limit)
+	}
+
+	if cursorString := query.Get("cursor"); cursorString != "" {
+		c, err := decodeCursor(cursorString)
+		if err != nil {
+			return page{}, err
+		}
+		p.After = &c
+	}
+	return p, nil
+}
+
+// setNextLink trims the extra row fetched by queryLimit and, if there was one,
+// advertises the next page in a Link header. It returns the number of items to
+// keep.
+func setNextLink(w http.ResponseWriter, r *http.Request, p page, n int, last func(i int) cursor) int {
+	if n <= int(p.Limit) {
+		return n
+	}
+	n = int(p.Limit)
+	next := last(n - 1).encode()
+
+	query := r.URL.Query()
+	query.Set("cursor", next)
+	nextURL := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextURL.String()))
+	w.Header().Set("X-Next-Cursor", next)
+	return n
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := cursor{
+		CreatedAt: time.Date(2024, 5, 6, 7, 8, 9, 123456000, time.UTC),
+		ID:        uuid.MustParse("3311741c-680c-4546-99f3-fc9efac2036c"),
+	}
+	got, err := decodeCursor(c.encode())
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if !got.CreatedAt.Equal(c.CreatedAt) || got.ID != c.ID {
+		t.Errorf("Got %+v, want %+v", got, c)
+	}
+
+	// Times in other zones are encoded in UTC.
+	local := cursor{CreatedAt: c.CreatedAt.In(time.FixedZone("UTC+2", 2*60*60)), ID: c.ID}
+	if local.encode() != c.encode() {
+		t.Errorf("Expected the same cursor regardless of time zone")
+	}
+}
+
+func TestDecodeCursorErrors(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	cases := map[string]string{
+		"not base64":   "!!!",
+		"no separator": encode("2024-05-06T07:08:09Z"),
+		"bad time":     encode("yesterday,3311741c-680c-4546-99f3-fc9efac2036c"),
+		"bad ID":       encode("2024-05-06T07:08:09Z,not-a-uuid"),
+		"empty":        "",
+	}
+	for name, s := range cases {
+		if _, err := decodeCursor(s); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	valid := cursor{CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), ID: uuid.New()}
+	cases := []struct {
+		query     string
+		wantLimit int32
+		wantAfter bool
+		wantErr   bool
+	}{
+		{"", defaultPageLimit, false, false},
+		{"limit=1", 1, false, false},
+		{"limit=100", 100, false, false},
+		{"limit=0", 0, false, true},
+		{"limit=101", 0, false, true},
+		{"limit=-5", 0, false, true},
+		{"limit=ten", 0, false, true},
+		{"cursor=" + valid.encode(), defaultPageLimit, true, false},
+		{"limit=10&cursor=" + valid.encode(), 10, true, false},
+		{"cursor=garbage", 0, false, true},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/api/chirps?"+c.query, nil)
+		p, err := parsePage(r)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", c.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.query, err)
+			continue
+		}
+		if p.Limit != c.wantLimit || (p.After != nil) != c.wantAfter {
+			t.Errorf("%q: got %+v", c.query, p)
+		}
+		if c.wantAfter && (*p.After != valid || p.afterID().UUID != valid.ID || !p.afterCreatedAt().Valid) {
+			t.Errorf("%q: got cursor %+v, want %+v", c.query, *p.After, valid)
+		}
+		if !c.wantAfter && (p.afterID().Valid || p.afterCreatedAt().Valid) {
+			t.Errorf("%q: expected no keyset arguments", c.query)
+		}
+	}
+}
+
+func TestSetNextLink(t *testing.T) {
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	last := func(i int) cursor { return cursor{CreatedAt: time.Unix(int64(i), 0), ID: ids[i]} }
+	p := page{Limit: 2}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/chirps?sort=desc&limit=2", nil)
+	if n := setNextLink(w, r, p, 2, last); n != 2 || w.Header().Get("Link") != "" {
+		t.Errorf("Full last page: got %d items and Link %q", n, w.Header().Get("Link"))
+	}
+
+	w = httptest.NewRecorder()
+	if n := setNextLink(w, r, p, 3, last); n != 2 {
+		t.Errorf("Got %d items, want 2", n)
+	}
+	next := w.Header().Get("X-Next-Cursor")
+	if next != last(1).encode() {
+		t.Errorf("X-Next-Cursor = %q, want the cursor of the second item", next)
+	}
+	want := `</api/chirps?cursor=` + next + `&limit=2&sort=desc>; rel="next"`
+	if got := w.Header().Get("Link"); got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/JoStMc/Chirpy/internal/auth"
+	"github.com/JoStMc/Chirpy/internal/database"
+)
+
+const defaultMinPasswordLength = 8
+
+// loadPasswordPolicy reads PASSWORD_MIN_LENGTH and, if set, opens the
+// breached password list at BREACHED_PASSWORDS_FILE.
+func loadPasswordPolicy() (auth.PasswordPolicy, error) {
+	policy := auth.PasswordPolicy{MinLength: defaultMinPasswordLength}
+	if value := os.Getenv("PASSWORD_MIN_LENGTH"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return auth.PasswordPolicy{}, fmt.Errorf("invalid PASSWORD_MIN_LENGTH: %q", value)
+		} 
+		policy.MinLength = n
+	} 
+	path := os.Getenv("BREACHED_PASSWORDS_FILE")
+	if path == "" {
+		log.Println("Warning: BREACHED_PASSWORDS_FILE is not set, so passwords aren't checked against known breaches")
+		return policy, nil
+	} 
+	list, err := auth.OpenBreachedList(path)
+	if err != nil {
+		return auth.PasswordPolicy{}, fmt.Errorf("unable to open breached password list: %w", err)
+	} 
+	policy.Breached = list
+	return policy, nil
+} 
+
+// checkNewPassword applies the password policy to a password being set,
+// responding with the reason if it isn't allowed.
+func (cfg *apiConfig) checkNewPassword(w http.ResponseWriter, password string) bool {
+	err := cfg.passwordPolicy.Check(password)
+	if errors.Is(err, auth.ErrWeakPassword) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid password: %v", err))
+		return false
+	} 
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking password: %v", err))
+		return false
+	} 
+	return true
+} 
+
+// rehashPassword upgrades the user's password hash to the current Argon2
+// parameters, now that the password is known. Failing to is only logged,
+// since the old hash still works.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, user database.User, password string) {
+	if !auth.NeedsRehash(user.HashedPassword, cfg.passwordParams) {
+		return
+	} 
+	newHash, err := auth.HashPassword(password, cfg.passwordParams)
+	if err == nil {
+		err = cfg.dbQueries.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+			NewHash: newHash,
+			ID: user.ID,
+			OldHash: user.HashedPassword,
+		})
+	} 
+	if err != nil {
+		log.Printf("Error rehashing password of user %s: %v", user.ID, err)
+	} 
+} 
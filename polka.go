@@ -1,47 +1,167 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/JoStMc/Chirpy/internal/auth"
+	"github.com/JoStMc/Chirpy/internal/database"
 	"github.com/google/uuid"
 )
 
-type upgradeUserRequest struct {
+const (
+	maxWebhookBodySize = 1 << 20
+	// rejectedWebhooksPerHour is how many failed deliveries are logged for
+	// each IP.
+	rejectedWebhooksPerHour = 60
+)
+
+type polkaWebhookRequest struct {
+	ID string `json:"id"`
     Event string `json:"event"`
     Data struct {
-		UserId uuid.UUID `json:"user_id"`
+		UserID uuid.UUID `json:"user_id"`
+		PeriodEnd *time.Time `json:"period_end"`
     } `json:"data"`
 } 
 
-func (cfg *apiConfig) handlerUpgradeUser(w http.ResponseWriter, r *http.Request) {
-	apiKey, err := auth.GetAPIKey(r.Header)
-	if err != nil || apiKey != cfg.polkaKey {
-	    respondWithError(w, http.StatusUnauthorized, "Invalid API key")
+// handlerPolkaWebhook applies subscription events from Polka, our payment
+// provider. Authentic deliveries are logged in full before they're
+// processed. Rejected ones are logged without their body, and not at all once
+// their IP has had rejectedWebhooksPerHour logged.
+func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error reading body: %v", err))
+		return
+	} 
+
+	// Once logged, the delivery is seen through even if Polka hangs up, so
+	// its outcome is always recorded.
+	ctx := context.WithoutCancel(r.Context())
+	if err := cfg.verifyPolkaWebhook(r, body); err != nil {
+		cfg.logRejectedWebhook(ctx, r, err)
+		respondWithError(w, http.StatusUnauthorized, err.Error())
 		return
 	} 
-	
-	data, err := decodeJSON[upgradeUserRequest](r)
+
+	delivery, err := cfg.logWebhookDelivery(ctx, r.Header, body)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error parsing JSON: %v", err))
+		// Without a log entry the event could be lost, so make Polka retry.
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error logging delivery: %v", err))
 		return
 	} 
-	if data.Event != "user.upgraded" {
-		w.WriteHeader(http.StatusNoContent)
+
+	// Only signed deliveries must have an event id. Those checked against
+	// POLKA_KEY may be in the old format, which didn't have one.
+	signed := len(cfg.polkaSecrets) > 0
+	result := cfg.applyPolkaDelivery(ctx, body, signed)
+	cfg.finishWebhookDelivery(ctx, delivery.ID, result)
+
+	if result.Err != nil {
+		respondWithError(w, result.Code, result.Err.Error())
 		return
 	} 
+	w.WriteHeader(result.Code)
+}
 
-	err = cfg.dbQueries.UpgradeUserToChirpyRed(r.Context(), data.Data.UserId)
+// logRejectedWebhook records a request that failed verification. Anyone can
+// send these, so the body isn't kept and each IP only gets
+// rejectedWebhooksPerHour entries.
+func (cfg *apiConfig) logRejectedWebhook(ctx context.Context, r *http.Request, verifyErr error) {
+	ip := clientInfoFromRequest(r).IP
+	if ok, _ := cfg.rejectedWebhookLimiter.Allow(ip, rejectedWebhooksPerHour); !ok {
+		return
+	} 
+	delivery, err := cfg.logWebhookDelivery(ctx, r.Header, []byte{})
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-		    respondWithError(w, http.StatusNotFound, "User not found")
-			return
-		} 
-		respondWithError(w, http.StatusInternalServerError, "Could not upgrade user")
+		log.Printf("Error logging rejected webhook delivery: %v", err)
 		return
 	} 
-	w.WriteHeader(http.StatusNoContent)
-}
+	cfg.finishWebhookDelivery(ctx, delivery.ID, deliveryResult{Status: deliveryRejected, Code: http.StatusUnauthorized, Err: verifyErr})
+} 
+
+// parsePolkaDelivery reads the event in a delivery. A result with an error
+// means the delivery is rejected.
+func parsePolkaDelivery(body []byte, requireID bool) (polkaWebhookRequest, deliveryResult) {
+	var data polkaWebhookRequest
+	if err := json.Unmarshal(body, &data); err != nil {
+		return data, deliveryResult{Status: deliveryRejected, Code: http.StatusBadRequest, Err: fmt.Errorf("Error parsing JSON: %v", err)}
+	} 
+	result := deliveryResult{EventID: data.ID, Event: data.Event}
+	if data.ID == "" && requireID {
+		result.Status, result.Code, result.Err = deliveryRejected, http.StatusBadRequest, errors.New("Missing event id")
+	} 
+	return data, result
+} 
+
+// applyPolkaDelivery parses and applies the body of a delivery whose
+// signature has already been checked. Events without an id can't be told
+// apart from a redelivery, so they're applied every time.
+func (cfg *apiConfig) applyPolkaDelivery(ctx context.Context, body []byte, requireID bool) deliveryResult {
+	data, result := parsePolkaDelivery(body, requireID)
+	if result.Err != nil {
+		return result
+	} 
+
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		result.Status, result.Code, result.Err = deliveryFailed, http.StatusInternalServerError, fmt.Errorf("Error starting transaction: %v", err)
+		return result
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	// The event is recorded in the same transaction that applies it, so it's
+	// either applied and recorded or neither, and Polka can safely retry.
+	if data.ID != "" {
+		recorded, err := qtx.RecordPolkaEvent(ctx, database.RecordPolkaEventParams{
+			ID: data.ID,
+			Event: data.Event,
+		})
+		if err != nil {
+			result.Status, result.Code, result.Err = deliveryFailed, http.StatusInternalServerError, fmt.Errorf("Error recording event: %v", err)
+			return result
+		} 
+		if recorded == 0 {
+			// Already applied; acknowledge the redelivery.
+			result.Status, result.Code = deliveryDuplicate, http.StatusNoContent
+			return result
+		} 
+	} 
+
+	if err := applyPolkaEvent(ctx, qtx, data); err != nil {
+		result.Status, result.Code, result.Err = deliveryFailed, http.StatusInternalServerError, fmt.Errorf("Error applying event: %v", err)
+		if errors.Is(err, errUserNotFound) || errors.Is(err, errSubscriptionNotFound) {
+			result.Code, result.Err = http.StatusNotFound, err
+		} 
+		return result
+	} 
+
+	if err := tx.Commit(); err != nil {
+		result.Status, result.Code, result.Err = deliveryFailed, http.StatusInternalServerError, fmt.Errorf("Error applying event: %v", err)
+		return result
+	} 
+	result.Status, result.Code = deliveryProcessed, http.StatusNoContent
+	return result
+} 
+
+// verifyPolkaWebhook checks the request's HMAC signature. Until signing
+// secrets are configured it falls back to the static API key.
+func (cfg *apiConfig) verifyPolkaWebhook(r *http.Request, body []byte) error {
+	if len(cfg.polkaSecrets) > 0 {
+		return auth.VerifyWebhook(r.Header, body, cfg.polkaSecrets, cfg.polkaTolerance, time.Now())
+	} 
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil || subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.polkaKey)) != 1 {
+		return errors.New("Invalid API key")
+	} 
+	return nil
+} 
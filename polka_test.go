@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParsePolkaDelivery(t *testing.T) {
+	legacy := []byte(`{"event": "user.upgraded", "data": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+	withID := []byte(`{"id": "evt_1", "event": "user.upgraded", "data": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+
+	cases := []struct {
+		name      string
+		body      []byte
+		requireID bool
+		wantCode  int
+	}{
+		{"legacy payload without id", legacy, false, 0},
+		{"signed payload without id", legacy, true, http.StatusBadRequest},
+		{"signed payload", withID, true, 0},
+		{"invalid JSON", []byte(`{"event":`), false, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		data, result := parsePolkaDelivery(c.body, c.requireID)
+		if c.wantCode == 0 {
+			if result.Err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, result.Err)
+			} else if data.Event != "user.upgraded" || data.Data.UserID.String() != "3311741c-680c-4546-99f3-fc9efac2036c" {
+				t.Errorf("%s: parsed %+v", c.name, data)
+			}
+			continue
+		}
+		if result.Err == nil || result.Code != c.wantCode || result.Status != deliveryRejected {
+			t.Errorf("%s: got %+v, want a rejection with %d", c.name, result, c.wantCode)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+var errUserNotFound = errors.New("User not found")
+
+// Profile is the public view of a user. It must never include the email or
+// password hash.
+type Profile struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Handle         *string   `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	FollowerCount  int32     `json:"follower_count"`
+	FollowingCount int32     `json:"following_count"`
+} 
+
+func profileFromDB(u database.User, plan userPlan) Profile {
+	return Profile{
+		ID: u.ID,
+		CreatedAt: u.CreatedAt,
+		Handle: nullStringPtr(u.Handle),
+		DisplayName: u.DisplayName,
+		Bio: u.Bio,
+		IsChirpyRed: plan.isChirpyRed(),
+		FollowerCount: u.FollowerCount,
+		FollowingCount: u.FollowingCount,
+	} 
+} 
+
+func (cfg *apiConfig) handlerGetProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.lookupUser(r, r.PathValue("handleOrID"))
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		} 
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving user: %v", err))
+		return
+	} 
+	plan, err := getUserPlan(r.Context(), cfg.dbQueries, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving plan: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, profileFromDB(user, plan))
+} 
+
+// lookupUser finds a user by ID, or by handle if handleOrID isn't a UUID.
+// Handles are matched case-insensitively.
+func (cfg *apiConfig) lookupUser(r *http.Request, handleOrID string) (database.User, error) {
+	var user database.User
+	var err error
+	if id, parseErr := uuid.Parse(handleOrID); parseErr == nil {
+		user, err = cfg.dbQueries.GetUserByID(r.Context(), id)
+	} else if handlePattern.MatchString(handleOrID) {
+		user, err = cfg.dbQueries.GetUserByHandle(r.Context(), handleOrID)
+	} else {
+		return database.User{}, errUserNotFound
+	} 
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, errUserNotFound
+	} 
+	return user, err
+} 
+
+func validateProfile(params updateUserRequest) error {
+	if params.Handle != nil && !handlePattern.MatchString(*params.Handle) {
+		return errors.New("Handle must be 3-30 letters, digits or underscores")
+	} 
+	if params.DisplayName != nil && utf8.RuneCountInString(*params.DisplayName) > maxDisplayNameLength {
+		return fmt.Errorf("Display name must be at most %d characters", maxDisplayNameLength)
+	} 
+	if params.Bio != nil && utf8.RuneCountInString(*params.Bio) > maxBioLength {
+		return fmt.Errorf("Bio must be at most %d characters", maxBioLength)
+	} 
+	return nil
+} 
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+} 
+
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	} 
+	return sql.NullString{String: *s, Valid: true}
+} 
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	} 
+	return &s.String
+} 
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+var errChirpNotFound = errors.New("chirp not found")
+
+// getOriginalChirp fetches a chirp to reply to, rechirp or quote. A rechirp
+// stands in for the chirp it rechirps, so that chirp is returned instead.
+func (cfg *apiConfig) getOriginalChirp(ctx context.Context, chirpID uuid.UUID) (database.Chirp, error) {
+	chirp, err := cfg.dbQueries.GetChirp(ctx, chirpID)
+	if err == nil && chirp.RechirpOf.Valid {
+		chirp, err = cfg.dbQueries.GetChirp(ctx, chirp.RechirpOf.UUID)
+	} 
+	if err != nil || chirp.DeletedAt.Valid {
+		return database.Chirp{}, errChirpNotFound
+	} 
+	return chirp, nil
+} 
+
+func (cfg *apiConfig) handlerRechirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprint(err))
+		return
+	} 
+	userID, err := cfg.scopedUserID(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithError(w, authErrorStatus(err), fmt.Sprint(err))
+		return
+	} 
+
+	ctx := r.Context()
+	original, err := cfg.getOriginalChirp(ctx, chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	} 
+	limits, err := cfg.entitlements.Limits(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking plan: %v", err))
+		return
+	} 
+	if !cfg.allowChirp(w, userID, limits) {
+		return
+	} 
+
+	// A rechirp has no body of its own, so it skips validateChirpBody.
+	chirp, _, err := cfg.createChirp(ctx, newChirp{
+		CreateChirpParams: database.CreateChirpParams{
+			UserID: userID,
+			RechirpOf: uuid.NullUUID{UUID: original.ID, Valid: true},
+		},
+		originalAuthorID: original.UserID,
+	})
+	if err != nil {
+		if isUniqueViolation(err, "chirps_user_id_rechirp_of_idx") {
+			respondWithError(w, http.StatusConflict, "Chirp already rechirped")
+			return
+		} 
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error rechirping chirp: %v", err))
+		return
+	} 
+
+	apiChirps := []Chirp{chirpFromDB(chirp)}
+	if err := cfg.populateChirps(r, apiChirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving chirp: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusCreated, apiChirps[0])
+} 
+
+func (cfg *apiConfig) handlerUndoRechirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprint(err))
+		return
+	} 
+	userID, err := cfg.scopedUserID(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithError(w, authErrorStatus(err), fmt.Sprint(err))
+		return
+	} 
+
+	if err := cfg.undoRechirp(r.Context(), userID, chirpID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error undoing rechirp: %v", err))
+		return
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
+
+// undoRechirp deletes the user's rechirp of a chirp, and the chirp too if it's
+// a tombstone that nothing else points at.
+func (cfg *apiConfig) undoRechirp(ctx context.Context, userID, chirpID uuid.UUID) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	deleted, err := qtx.DeleteRechirp(ctx, database.DeleteRechirpParams{
+		UserID: userID,
+		RechirpOf: uuid.NullUUID{UUID: chirpID, Valid: true},
+	})
+	if err != nil {
+		return err
+	} 
+	if deleted > 0 {
+		if err := deleteUnreferencedTombstones(ctx, qtx, chirpID); err != nil {
+			return err
+		} 
+	} 
+	return tx.Commit()
+} 
+
+// setOriginals embeds the chirp each rechirp or quote points at. Originals are
+// only embedded one level deep.
+func (cfg *apiConfig) setOriginals(r *http.Request, chirps []Chirp) error {
+	var ids []uuid.UUID
+	for _, c := range chirps {
+		if c.RechirpOf != nil {
+			ids = append(ids, *c.RechirpOf)
+		} else if c.QuoteOf != nil {
+			ids = append(ids, *c.QuoteOf)
+		} 
+	} 
+	if len(ids) == 0 {
+		return nil
+	} 
+
+	dbOriginals, err := cfg.dbQueries.GetChirpsByIDs(r.Context(), ids)
+	if err != nil {
+		return err
+	} 
+	originals := make([]Chirp, len(dbOriginals))
+	for i, c := range dbOriginals {
+		originals[i] = chirpFromDB(c)
+	} 
+	if err := cfg.setChirpDetails(r, originals); err != nil {
+		return err
+	} 
+
+	byID := make(map[uuid.UUID]*Chirp, len(originals))
+	for i := range originals {
+		byID[originals[i].ID] = &originals[i]
+	} 
+	for i := range chirps {
+		if chirps[i].RechirpOf != nil {
+			chirps[i].Original = byID[*chirps[i].RechirpOf]
+		} else if chirps[i].QuoteOf != nil {
+			chirps[i].Original = byID[*chirps[i].QuoteOf]
+		} 
+	} 
+	return nil
+} 
@@ -1,18 +1,27 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/JoStMc/Chirpy/internal/auth"
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
 )
 
 type refreshResponse struct {
     Token string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
 } 
 
+// handlerRefresh exchanges a refresh token for a new access token and a new
+// refresh token, revoking the one presented. Tokens rotated from the same
+// login form a family; a revoked token being presented again means it was
+// copied, so the whole family is revoked.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -20,29 +29,103 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	} 
 
-	ctx := r.Context()
-	userTokens, err := cfg.dbQueries.GetUserFromRefreshToken(ctx, token)
+	tokenHash := auth.HashToken(token)
+	client := clientInfoFromRequest(r)
+	// A detected reuse must revoke the family even if the client hangs up.
+	ctx := context.WithoutCancel(r.Context())
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error starting transaction: %v", err))
+		return
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	userTokens, err := qtx.GetUserFromRefreshToken(ctx, tokenHash)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "invalid token")
 		return
 	} 
 
-	if userTokens.ExpiresAt.Before(time.Now()) || userTokens.RevokedAt.Valid {
+	if userTokens.RevokedAt.Valid {
+		cfg.revokeStolenFamily(ctx, w, tx, qtx, userTokens.UserID, userTokens.FamilyID)
+		return
+	} 
+	if userTokens.ExpiresAt.Before(time.Now()) {
 		respondWithError(w, http.StatusUnauthorized, "token expired")
 		return
 	} 
+	if cfg.blocksUnverified(userTokens.EmailVerifiedAt.Valid) {
+		respondWithError(w, http.StatusForbidden, "Email address not verified")
+		return
+	} 
+
+	// Only revoke if nobody else has, so two refreshes racing with the same
+	// token can't both succeed.
+	revoked, err := qtx.RevokeRefreshToken(ctx, tokenHash)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error revoking token: %v", err))
+		return
+	} 
+	if revoked == 0 {
+		cfg.revokeStolenFamily(ctx, w, tx, qtx, userTokens.UserID, userTokens.FamilyID)
+		return
+	} 
+
+	err = qtx.TouchSession(ctx, database.TouchSessionParams{
+		ID: userTokens.FamilyID,
+		UserAgent: client.UserAgent,
+		Ip: client.IP,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error updating session: %v", err))
+		return
+	} 
 
-	jwtoken, err := auth.MakeJWT(userTokens.UserID, cfg.jwtSecret, 3600 * time.Second)
+	refreshToken := auth.MakeRefreshToken()
+	_, err = qtx.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID: userTokens.UserID,
+		FamilyID: userTokens.FamilyID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error creating refresh token: %v", err))
+		return
+	} 
+
+	jwtoken, err := auth.MakeJWT(userTokens.UserID, userTokens.FamilyID, cfg.scopesFor(userTokens.EmailVerifiedAt.Valid), cfg.jwtKeys, 3600 * time.Second)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error generating token: %v", err))
 		return
 	} 
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error rotating token: %v", err))
+		return
+	} 
 	response := refreshResponse{
 	    Token: jwtoken,
+		RefreshToken: refreshToken,
 	} 
 	respondWithJSON(w, http.StatusOK, response)
 } 
 
+// revokeStolenFamily handles an already rotated refresh token being reused.
+// Either the client or an attacker holds a copy, and there's no telling
+// which, so every token in the family is revoked and both have to log in.
+func (cfg *apiConfig) revokeStolenFamily(ctx context.Context, w http.ResponseWriter, tx *sql.Tx, qtx *database.Queries, userID, familyID uuid.UUID) {
+	if _, err := qtx.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error revoking tokens: %v", err))
+		return
+	} 
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error revoking tokens: %v", err))
+		return
+	} 
+	log.Printf("Possible refresh token theft: revoked token family %s of user %s was reused", familyID, userID)
+	respondWithError(w, http.StatusUnauthorized, "token revoked")
+} 
+
 
 func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetBearerToken(r.Header)
@@ -52,8 +135,8 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 	} 
 
 	ctx := r.Context()
-	err = cfg.dbQueries.RevokeRefreshToken(ctx, token)
-	if err != nil && err != sql.ErrNoRows {
+	_, err = cfg.dbQueries.RevokeRefreshToken(ctx, auth.HashToken(token))
+	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error revoking token: %v", err))
 		return
 	} 
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultReplyDepth = 3
+	maxReplyDepth     = 10
+)
+
+type threadReply struct {
+	Chirp
+	Depth int32 `json:"depth"`
+} 
+
+func (cfg *apiConfig) handlerGetReplies(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprint(err))
+		return
+	} 
+
+	depth := defaultReplyDepth
+	if depthString := r.URL.Query().Get("depth"); depthString != "" {
+		depth, err = strconv.Atoi(depthString)
+		if err != nil || depth < 1 || depth > maxReplyDepth {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("depth must be between 1 and %d", maxReplyDepth))
+			return
+		} 
+	} 
+
+	p, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	} 
+
+	ctx := r.Context()
+	if _, err := cfg.dbQueries.GetChirp(ctx, chirpID); err != nil {
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	} 
+
+	rows, err := cfg.dbQueries.GetReplies(ctx, database.GetRepliesParams{
+		ChirpID: chirpID,
+		MaxDepth: int32(depth),
+		AfterCreatedAt: p.afterCreatedAt(),
+		AfterID: p.afterID(),
+		Limit: p.queryLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving replies: %v", err))
+		return
+	} 
+
+	n := setNextLink(w, r, p, len(rows), func(i int) cursor {
+		return cursor{CreatedAt: rows[i].Chirp.CreatedAt, ID: rows[i].Chirp.ID}
+	})
+	chirps := make([]Chirp, n)
+	for i, row := range rows[:n] {
+		chirps[i] = chirpFromDB(row.Chirp)
+	} 
+	if err := cfg.populateChirps(r, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving replies: %v", err))
+		return
+	} 
+
+	replies := make([]threadReply, n)
+	for i, row := range rows[:n] {
+		replies[i] = threadReply{
+			Chirp: chirps[i],
+			Depth: row.Depth,
+		} 
+	} 
+	respondWithJSON(w, http.StatusOK, replies)
+} 
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/google/uuid"
+)
+
+// userRole is what a user may do beyond their own account. Each role can do
+// everything the roles before it can.
+type userRole string
+
+const (
+	roleUser userRole = "user"
+	// roleModerator can delete anyone's chirps.
+	roleModerator userRole = "moderator"
+	// roleAdmin can use the /admin endpoints.
+	roleAdmin userRole = "admin"
+)
+
+var roleRanks = map[userRole]int{
+	roleUser: 0,
+	roleModerator: 1,
+	roleAdmin: 2,
+} 
+
+func (r userRole) atLeast(min userRole) bool {
+	rank, ok := roleRanks[r]
+	return ok && rank >= roleRanks[min]
+} 
+
+// userRole looks up the user's current role, rather than trusting one from
+// a token, so demoting someone takes effect immediately.
+func (cfg *apiConfig) userRole(ctx context.Context, userID uuid.UUID) (userRole, error) {
+	user, err := cfg.dbQueries.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	} 
+	return userRole(user.Role), nil
+} 
+
+// middlewareRequireRole only lets through requests with the access token of
+// a user who has at least the required role. API keys aren't accepted.
+func (cfg *apiConfig) middlewareRequireRole(required userRole, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := cfg.authenticatedUserID(r)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+			return
+		} 
+		role, err := cfg.userRole(r.Context(), userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusUnauthorized, "User not found")
+			return
+		} 
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving user: %v", err))
+			return
+		} 
+		if !role.atLeast(required) {
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("Requires the %s role", required))
+			return
+		} 
+		next.ServeHTTP(w, r)
+	})
+} 
+
+// bootstrapAdmin promotes the user with ADMIN_EMAIL to admin on start, so
+// there's a way to get the first admin without touching the database. It's
+// only logged if the user doesn't exist or hasn't verified the address yet;
+// restarting once they have will promote them.
+func (cfg *apiConfig) bootstrapAdmin(ctx context.Context) error {
+	email := os.Getenv("ADMIN_EMAIL")
+	if email == "" {
+		return nil
+	} 
+	promoted, err := cfg.dbQueries.PromoteUserToAdmin(ctx, email)
+	if err != nil {
+		return fmt.Errorf("unable to promote ADMIN_EMAIL: %w", err)
+	} 
+	if promoted == 0 {
+		log.Printf("Warning: ADMIN_EMAIL %s isn't a user with a verified email, so it wasn't made an admin", email)
+	} 
+	return nil
+} 
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/JoStMc/Chirpy/internal/entitlements"
+	"github.com/google/uuid"
+)
+
+// ScheduledChirp is a chirp waiting for its publish time. Only its author can
+// see it.
+type ScheduledChirp struct {
+	ID        uuid.UUID  `json:"id"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	QuoteOf   *uuid.UUID `json:"quote_of"`
+	PublishAt time.Time  `json:"publish_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	// FailedAt is set once publishing has been given up on.
+	FailedAt  *time.Time `json:"failed_at"`
+} 
+
+func scheduledChirpFromDB(c database.ScheduledChirp) ScheduledChirp {
+	chirp := ScheduledChirp{
+		ID: c.ID,
+		Body: c.Body,
+		UserID: c.UserID,
+		PublishAt: c.PublishAt,
+		CreatedAt: c.CreatedAt,
+	} 
+	if c.ParentID.Valid {
+		chirp.InReplyTo = &c.ParentID.UUID
+	} 
+	if c.QuoteOf.Valid {
+		chirp.QuoteOf = &c.QuoteOf.UUID
+	} 
+	if c.FailedAt.Valid {
+		chirp.FailedAt = &c.FailedAt.Time
+	} 
+	return chirp
+} 
+
+// scheduleChirp is handlerCreateChirp for a chirp with a publish_at. The body
+// has already been validated against the user's plan.
+func (cfg *apiConfig) scheduleChirp(w http.ResponseWriter, r *http.Request, params createChirpRequests, limits entitlements.Limits) {
+	if !limits.ScheduledPosting {
+		respondWithError(w, http.StatusForbidden, "Scheduled posting requires Chirpy Red")
+		return
+	} 
+	if len(params.Images) > 0 {
+		respondWithError(w, http.StatusBadRequest, "Scheduled chirps can't have images")
+		return
+	} 
+	if !params.PublishAt.After(time.Now()) {
+		respondWithError(w, http.StatusBadRequest, "publish_at must be in the future")
+		return
+	} 
+
+	ctx := r.Context()
+	arg := database.CreateScheduledChirpParams{
+		UserID: params.UserID,
+		Body: params.Body,
+		// Timestamps are stored without a zone, so keep them all in UTC.
+		PublishAt: params.PublishAt.UTC(),
+	} 
+	if params.InReplyTo != nil {
+		parent, err := cfg.getOriginalChirp(ctx, *params.InReplyTo)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "Chirp being replied to not found")
+			return
+		} 
+		arg.ParentID = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	} 
+	if params.QuoteOf != nil {
+		quoted, err := cfg.getOriginalChirp(ctx, *params.QuoteOf)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, "Chirp being quoted not found")
+			return
+		} 
+		arg.QuoteOf = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	} 
+
+	scheduled, err := cfg.dbQueries.CreateScheduledChirp(ctx, arg)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error scheduling chirp: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusAccepted, scheduledChirpFromDB(scheduled))
+} 
+
+func (cfg *apiConfig) handlerGetScheduledChirps(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.scopedUserID(r, scopeChirpsRead)
+	if err != nil {
+		respondWithError(w, authErrorStatus(err), fmt.Sprint(err))
+		return
+	} 
+
+	scheduled, err := cfg.dbQueries.ListScheduledChirps(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving scheduled chirps: %v", err))
+		return
+	} 
+	chirps := make([]ScheduledChirp, len(scheduled))
+	for i, c := range scheduled {
+		chirps[i] = scheduledChirpFromDB(c)
+	} 
+	respondWithJSON(w, http.StatusOK, chirps)
+} 
+
+func (cfg *apiConfig) handlerCancelScheduledChirp(w http.ResponseWriter, r *http.Request) {
+	scheduledID, err := uuid.Parse(r.PathValue("scheduledID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprint(err))
+		return
+	} 
+	userID, err := cfg.scopedUserID(r, scopeChirpsWrite)
+	if err != nil {
+		respondWithError(w, authErrorStatus(err), fmt.Sprint(err))
+		return
+	} 
+
+	deleted, err := cfg.dbQueries.DeleteScheduledChirp(r.Context(), database.DeleteScheduledChirpParams{
+		ID: scheduledID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error cancelling chirp: %v", err))
+		return
+	} 
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Scheduled chirp not found")
+		return
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
+
+// publishScheduledChirps publishes due chirps every interval. It runs for the
+// life of the server.
+func (cfg *apiConfig) publishScheduledChirps(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx := context.Background()
+		for {
+			scheduled, published, err := cfg.publishNextScheduledChirp(ctx)
+			if err != nil && scheduled.ID != uuid.Nil {
+				log.Printf("Error publishing scheduled chirp %s: %v", scheduled.ID, err)
+				if err := cfg.recordScheduledChirpFailure(ctx, scheduled, err); err != nil {
+					log.Printf("Error recording scheduled chirp failure: %v", err)
+					break
+				} 
+				continue
+			} 
+			if err != nil {
+				log.Printf("Error publishing scheduled chirp: %v", err)
+				break
+			} 
+			if !published {
+				break
+			} 
+		} 
+	} 
+} 
+
+// maxScheduledChirpAttempts is how many times a scheduled chirp is tried
+// before it's given up on. It waits a minute longer after each failure.
+const maxScheduledChirpAttempts = 5
+
+// recordScheduledChirpFailure puts a chirp that failed to publish back for a
+// later retry, so that it doesn't block the chirps due after it.
+func (cfg *apiConfig) recordScheduledChirpFailure(ctx context.Context, scheduled database.ScheduledChirp, publishErr error) error {
+	retryAt := time.Now().UTC().Add(time.Duration(scheduled.Attempts+1) * time.Minute)
+	return cfg.dbQueries.RecordScheduledChirpFailure(ctx, database.RecordScheduledChirpFailureParams{
+		LastError: sql.NullString{String: publishErr.Error(), Valid: true},
+		RetryAt: sql.NullTime{Time: retryAt, Valid: true},
+		MaxAttempts: maxScheduledChirpAttempts,
+		ID: scheduled.ID,
+	})
+} 
+
+// publishNextScheduledChirp posts one due chirp, if there is one. The chirp is
+// claimed and posted in the same transaction, so it's published exactly once
+// even with several servers running. If it fails after claiming a chirp, the
+// claim is rolled back and the chirp is returned with the error.
+func (cfg *apiConfig) publishNextScheduledChirp(ctx context.Context) (database.ScheduledChirp, bool, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.ScheduledChirp{}, false, err
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	scheduled, err := qtx.ClaimDueScheduledChirp(ctx, time.Now().UTC())
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.ScheduledChirp{}, false, nil
+	} 
+	if err != nil {
+		return database.ScheduledChirp{}, false, err
+	} 
+
+	nc := newChirp{
+		CreateChirpParams: database.CreateChirpParams{
+			Body: scheduled.Body,
+			UserID: scheduled.UserID,
+			ParentID: scheduled.ParentID,
+			QuoteOf: scheduled.QuoteOf,
+		},
+		tags: extractHashtags(scheduled.Body),
+	} 
+	if scheduled.ParentID.Valid {
+		parent, err := qtx.GetChirp(ctx, scheduled.ParentID.UUID)
+		if err != nil {
+			return scheduled, false, err
+		} 
+		nc.parentAuthorID = parent.UserID
+	} 
+	if scheduled.QuoteOf.Valid {
+		quoted, err := qtx.GetChirp(ctx, scheduled.QuoteOf.UUID)
+		if err != nil {
+			return scheduled, false, err
+		} 
+		nc.originalAuthorID = quoted.UserID
+	} 
+	nc.mentions, err = cfg.resolveMentions(ctx, scheduled.Body)
+	if err != nil {
+		return scheduled, false, err
+	} 
+
+	if _, _, err := insertChirp(ctx, qtx, nc); err != nil {
+		return scheduled, false, err
+	} 
+	return scheduled, true, tx.Commit()
+} 
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+)
+
+type searchResult struct {
+	Chirp
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+func (cfg *apiConfig) handlerSearchChirps(w http.ResponseWriter, r *http.Request) {
+	query := buildTSQuery(r.URL.Query().Get("q"))
+	if query == "" {
+		respondWithError(w, http.StatusBadRequest, "Search query must contain at least one word")
+		return
+	}
+
+	authorID, err := cfg.parseAuthorID(r)
+	if err != nil {
+		respondWithAuthorError(w, err)
+		return
+	}
+
+	// Results are ordered by rank, which a cursor can't resume from, so
+	// search pages by offset instead.
+	if r.URL.Query().Has("cursor") {
+		respondWithError(w, http.StatusBadRequest, "Search is paged with offset, not cursor")
+		return
+	}
+	p, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset := 0
+	if offsetString := r.URL.Query().Get("offset"); offsetString != "" {
+		offset, err = strconv.Atoi(offsetString)
+		if err != nil || offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid offset")
+			return
+		}
+	}
+
+	rows, err := cfg.dbQueries.SearchChirps(r.Context(), database.SearchChirpsParams{
+		Query: query,
+		AuthorID: authorID,
+		Limit: p.queryLimit(),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error searching chirps: %v", err))
+		return
+	}
+	if len(rows) > int(p.Limit) {
+		rows = rows[:p.Limit]
+		setNextOffsetLink(w, r, offset+int(p.Limit))
+	}
+
+	chirps := make([]Chirp, len(rows))
+	for i, row := range rows {
+		chirps[i] = chirpFromDB(row.Chirp)
+	}
+	if err := cfg.populateChirps(r, chirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error searching chirps: %v", err))
+		return
+	}
+
+	results := make([]searchResult, len(rows))
+	for i, row := range rows {
+		results[i] = searchResult{
+			Chirp: chirps[i],
+			Rank: row.Rank,
+			Snippet: row.Snippet,
+		}
+	}
+	respondWithJSON(w, http.StatusOK, results)
+}
+
+// setNextOffsetLink advertises the next page of an offset paged list in a
+// Link header, like setNextLink does for cursors.
+func setNextOffsetLink(w http.ResponseWriter, r *http.Request, offset int) {
+	query := r.URL.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	nextURL := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextURL.String()))
+}
+
+// buildTSQuery turns a user's search string into to_tsquery syntax.
+// "Quoted text" becomes a phrase, a trailing * makes a prefix match, and every
+// other word must match. Anything that isn't a letter or digit is dropped so
+// user input can never produce a tsquery syntax error.
+func buildTSQuery(q string) string {
+	var terms []string
+	for i, part := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			if phrase := tsPhrase(strings.Fields(part)); phrase != "" {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			if term := tsPhrase([]string{word}); term != "" {
+				terms = append(terms, term)
+			}
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+// tsPhrase joins words with the followed-by operator. A word ending in * is
+// matched as a prefix.
+func tsPhrase(words []string) string {
+	var lexemes []string
+	for _, word := range words {
+		prefix := strings.HasSuffix(word, "*")
+		parts := strings.FieldsFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(parts) == 0 {
+			continue
+		}
+		if prefix {
+			parts[len(parts)-1] += ":*"
+		}
+		lexemes = append(lexemes, parts...)
+	}
+	if len(lexemes) > 1 {
+		return "(" + strings.Join(lexemes, " <-> ") + ")"
+	}
+	return strings.Join(lexemes, "")
+}
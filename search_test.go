@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildTSQuery(t *testing.T) {
+	cases := []struct {
+		q    string
+		want string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"chirp", "chirp"},
+		{"hello world", "hello & world"},
+		{"chirp*", "chirp:*"},
+		{`"hello world"`, "(hello <-> world)"},
+		{`"hello world" bird`, "(hello <-> world) & bird"},
+		{`"hello wor*"`, "(hello <-> wor:*)"},
+		{`"single"`, "single"},
+		// Operators and punctuation can't break out of the query.
+		{"a & b | !c", "a & b & c"},
+		{"it's", "(it <-> s)"},
+		{"(foo:*) <-> bar", "foo & bar"},
+		{"!!! ***", ""},
+		// An unclosed quote still makes a phrase of the rest.
+		{`bird "hello world`, "bird & (hello <-> world)"},
+		{"über café", "über & café"},
+		{"chirp2024", "chirp2024"},
+	}
+	for _, c := range cases {
+		if got := buildTSQuery(c.q); got != c.want {
+			t.Errorf("buildTSQuery(%q) = %q, want %q", c.q, got, c.want)
+		}
+	}
+}
+
+func TestSetNextOffsetLink(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/chirps/search?q=bird&limit=10&offset=20", nil)
+	w := httptest.NewRecorder()
+	setNextOffsetLink(w, r, 30)
+	if got, want := w.Header().Get("Link"), `</api/chirps/search?limit=10&offset=30&q=bird>; rel="next"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/auth"
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// maxUserAgentLength caps what's stored of a client's User-Agent header.
+const maxUserAgentLength = 256
+
+// Session is one login, on one device, that can still refresh its tokens.
+// Its ID is shared by every refresh token rotated from that login.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+} 
+
+// clientInfo is what's recorded about the device behind a session.
+type clientInfo struct {
+	UserAgent string
+	IP        string
+} 
+
+// clientInfoFromRequest reads the client's user agent and IP. The IP is the
+// connection's remote address, since forwarding headers can be set by anyone.
+func clientInfoFromRequest(r *http.Request) clientInfo {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	} 
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	} 
+	return clientInfo{UserAgent: userAgent, IP: ip}
+} 
+
+// startSession records a new login for userID and issues the first refresh
+// token of its family.
+func (cfg *apiConfig) startSession(ctx context.Context, userID uuid.UUID, client clientInfo) (uuid.UUID, string, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, "", err
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	session, err := qtx.CreateSession(ctx, database.CreateSessionParams{
+		UserID: userID,
+		UserAgent: client.UserAgent,
+		Ip: client.IP,
+	})
+	if err != nil {
+		return uuid.Nil, "", err
+	} 
+	refreshToken := auth.MakeRefreshToken()
+	_, err = qtx.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		UserID: userID,
+		FamilyID: session.ID,
+	})
+	if err != nil {
+		return uuid.Nil, "", err
+	} 
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, "", err
+	} 
+	return session.ID, refreshToken, nil
+} 
+
+func (cfg *apiConfig) handlerGetSessions(w http.ResponseWriter, r *http.Request) {
+	claims, err := cfg.authenticatedClaims(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+	userID, err := claims.UserID()
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+
+	rows, err := cfg.dbQueries.ListActiveSessions(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving sessions: %v", err))
+		return
+	} 
+	sessions := make([]Session, len(rows))
+	for i, s := range rows {
+		sessions[i] = Session{
+			ID: s.ID,
+			CreatedAt: s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt: s.ExpiresAt,
+			UserAgent: s.UserAgent,
+			IP: s.Ip,
+			Current: s.ID == claims.Session(),
+		} 
+	} 
+	respondWithJSON(w, http.StatusOK, sessions)
+} 
+
+// handlerRevokeSession logs one of the user's sessions out. Access tokens
+// already issued to it stay valid until they expire.
+func (cfg *apiConfig) handlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprint(err))
+		return
+	} 
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+
+	revoked, err := cfg.dbQueries.RevokeUserRefreshTokenFamily(r.Context(), database.RevokeUserRefreshTokenFamilyParams{
+		FamilyID: sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error revoking session: %v", err))
+		return
+	} 
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
+
+// handlerRevokeAllSessions logs the user out everywhere, including the
+// session making the request.
+func (cfg *apiConfig) handlerRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+
+	// No session has a nil ID, so none is kept.
+	_, err = cfg.dbQueries.RevokeOtherUserRefreshTokens(r.Context(), database.RevokeOtherUserRefreshTokensParams{
+		UserID: userID,
+		KeepFamilyID: uuid.Nil,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error revoking sessions: %v", err))
+		return
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
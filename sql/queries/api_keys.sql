@@ -0,0 +1,20 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, user_id, name, key_hash, prefix, scopes, created_at)
+VALUES  (gen_random_uuid(),      $1,   $2,       $3,     $4,     $5,      NOW())
+RETURNING *;
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at DESC, id ASC;
+
+-- name: DeleteAPIKey :execrows
+DELETE FROM api_keys
+WHERE id = $1 AND user_id = $2;
+
+-- UseAPIKey looks a key up by its hash, recording that it was used.
+-- name: UseAPIKey :one
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE key_hash = $1
+RETURNING *;
@@ -0,0 +1,14 @@
+-- name: CreateChirpAttachment :one
+INSERT INTO chirp_attachments (id, chirp_id, position, content_type, blob_key, width, height, thumb_key, thumb_width, thumb_height, created_at)
+VALUES           (gen_random_uuid(),       $1,       $2,           $3,       $4,    $5,     $6,        $7,          $8,           $9,      NOW())
+RETURNING *;
+
+-- name: GetChirpAttachments :many
+SELECT * FROM chirp_attachments
+WHERE chirp_id = ANY(sqlc.arg('chirp_ids')::uuid[])
+ORDER BY chirp_id, position;
+
+-- name: DeleteChirpAttachments :many
+DELETE FROM chirp_attachments
+WHERE chirp_id = $1
+RETURNING *;
@@ -0,0 +1,28 @@
+-- name: CreateChirpTags :exec
+INSERT INTO chirp_tags (chirp_id, tag, created_at)
+SELECT sqlc.arg('chirp_id')::uuid, unnest(sqlc.arg('tags')::text[]), sqlc.arg('created_at')::timestamp
+ON CONFLICT (chirp_id, tag) DO NOTHING;
+
+-- name: DeleteChirpTags :exec
+DELETE FROM chirp_tags
+WHERE chirp_id = $1;
+
+-- name: ListChirpsByTag :many
+SELECT chirps.* FROM chirp_tags
+INNER JOIN chirps ON chirps.id = chirp_tags.chirp_id
+WHERE chirp_tags.tag = sqlc.arg('tag')
+  AND chirps.deleted_at IS NULL
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+       OR (chirp_tags.created_at, chirp_tags.chirp_id) < (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY chirp_tags.created_at DESC, chirp_tags.chirp_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetTrendingTags :many
+SELECT tag,
+       COUNT(*) AS uses,
+       SUM(POWER(0.5, EXTRACT(EPOCH FROM (NOW() - created_at)) / sqlc.arg('half_life_seconds')::float8))::float8 AS score
+FROM chirp_tags
+WHERE created_at > NOW() - make_interval(secs => sqlc.arg('window_seconds')::float8)
+GROUP BY tag
+ORDER BY score DESC, tag ASC
+LIMIT sqlc.arg('limit');
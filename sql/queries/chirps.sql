@@ -1,18 +1,88 @@
 -- name: CreateChirp :one
-INSERT INTO chirps    (id, created_at, updated_at, body, user_id)
-VALUES (gen_random_uuid(),      NOW(),      NOW(),   $1,      $2)
+INSERT INTO chirps    (id, created_at, updated_at, body, user_id, parent_id, rechirp_of, quote_of)
+VALUES (gen_random_uuid(),      NOW(),      NOW(),   $1,      $2,        $3,         $4,       $5)
 RETURNING *;
 
--- name: GetAllChirps :many
+-- name: ListChirpsAsc :many
 SELECT * FROM chirps
-WHERE (sqlc.arg(user_id) = '' OR user_id = sqlc.arg(user_id)::uuid)
-ORDER BY created_at ASC;
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+       OR (created_at, id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+  AND (sqlc.narg('after_created_at')::timestamp IS NULL
+       OR (created_at, id) < (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
 
 -- name: GetChirp :one
 SELECT * FROM chirps
 WHERE id = $1
 ORDER BY created_at ASC;
 
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: IsChirpQuoted :one
+SELECT EXISTS(SELECT 1 FROM chirps WHERE quote_of = $1);
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2;
+
+-- name: GetChirpForUpdate :one
+SELECT * FROM chirps
+WHERE id = $1
+FOR UPDATE;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps WHERE id = $1;
+
+-- name: TombstoneChirp :exec
+UPDATE chirps
+SET body = '', updated_at = NOW(), deleted_at = NOW()
+WHERE id = $1;
+
+-- name: GetReplies :many
+WITH RECURSIVE thread(id, depth) AS (
+    SELECT chirps.id, 1
+    FROM chirps
+    WHERE chirps.parent_id = sqlc.arg('chirp_id')
+  UNION ALL
+    SELECT chirps.id, thread.depth + 1
+    FROM chirps
+    INNER JOIN thread ON chirps.parent_id = thread.id
+    WHERE thread.depth < sqlc.arg('max_depth')::int
+)
+SELECT sqlc.embed(chirps), thread.depth
+FROM thread
+INNER JOIN chirps ON chirps.id = thread.id
+WHERE (sqlc.narg('after_created_at')::timestamp IS NULL
+       OR (chirps.created_at, chirps.id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: SearchChirps :many
+SELECT sqlc.embed(chirps),
+       ts_rank(to_tsvector('english', body), to_tsquery('english', sqlc.arg('query'))) AS rank,
+       ts_headline('english', body, to_tsquery('english', sqlc.arg('query')),
+                   'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MinWords=5, MaxWords=20')::text AS snippet
+FROM chirps
+WHERE to_tsvector('english', body) @@ to_tsquery('english', sqlc.arg('query'))
+  AND deleted_at IS NULL
+  AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+ORDER BY rank DESC, created_at DESC, id DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
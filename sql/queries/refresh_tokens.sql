@@ -1,15 +1,32 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id,                  expires_at, revoked_at)
-VALUES                     ($1,         NOW(),      NOW(),      $2, NOW() + INTERVAL '60 days' ,       NULL)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id,                  expires_at, revoked_at, family_id)
+VALUES                     ($1,              NOW(),      NOW(),      $2, NOW() + INTERVAL '60 days' ,       NULL,        $3)
 RETURNING *;
 
 -- name: GetUserFromRefreshToken :one
 SELECT * FROM refresh_tokens 
 INNER JOIN users ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1;
+WHERE refresh_tokens.token_hash = $1;
 
 
--- name: RevokeRefreshToken :exec
+-- name: RevokeRefreshToken :execrows
 UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
-WHERE token = $1;
+WHERE token_hash = $1 AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- RevokeOtherUserRefreshTokens logs the user out of every session except
+-- keep_family_id, which may be a UUID matching none.
+-- name: RevokeOtherUserRefreshTokens :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND family_id <> sqlc.arg('keep_family_id') AND revoked_at IS NULL;
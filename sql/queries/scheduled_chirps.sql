@@ -0,0 +1,37 @@
+-- name: CreateScheduledChirp :one
+INSERT INTO scheduled_chirps (id, user_id, body, parent_id, quote_of, publish_at, created_at)
+VALUES          (gen_random_uuid(),      $1,   $2,        $3,       $4,         $5,      NOW())
+RETURNING *;
+
+-- name: ListScheduledChirps :many
+SELECT * FROM scheduled_chirps
+WHERE user_id = $1
+ORDER BY publish_at ASC, id ASC;
+
+-- name: DeleteScheduledChirp :execrows
+DELETE FROM scheduled_chirps
+WHERE id = $1 AND user_id = $2;
+
+-- ClaimDueScheduledChirp takes one chirp that is due, skipping any that
+-- another server is already publishing.
+-- name: ClaimDueScheduledChirp :one
+DELETE FROM scheduled_chirps
+WHERE id = (
+    SELECT id FROM scheduled_chirps
+    WHERE publish_at <= sqlc.arg('now') AND failed_at IS NULL
+      AND (retry_at IS NULL OR retry_at <= sqlc.arg('now'))
+    ORDER BY publish_at ASC
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- RecordScheduledChirpFailure puts off a chirp that couldn't be published
+-- until retry_at, or gives up on it once it has failed max_attempts times.
+-- name: RecordScheduledChirpFailure :exec
+UPDATE scheduled_chirps
+SET attempts = attempts + 1,
+    last_error = sqlc.arg('last_error'),
+    retry_at = sqlc.arg('retry_at'),
+    failed_at = CASE WHEN attempts + 1 >= sqlc.arg('max_attempts')::int THEN NOW() END
+WHERE id = sqlc.arg('id');
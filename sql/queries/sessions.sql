@@ -0,0 +1,19 @@
+-- name: CreateSession :one
+INSERT INTO sessions (id, user_id, created_at, last_used_at, user_agent, ip)
+VALUES  (gen_random_uuid(),      $1,      NOW(),        NOW(),         $2, $3)
+RETURNING *;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_used_at = NOW(), user_agent = $2, ip = $3
+WHERE id = $1;
+
+-- ListActiveSessions returns the user's sessions that still hold a live
+-- refresh token, along with when that token expires.
+-- name: ListActiveSessions :many
+SELECT sessions.*, refresh_tokens.expires_at FROM sessions
+INNER JOIN refresh_tokens ON refresh_tokens.family_id = sessions.id
+WHERE sessions.user_id = $1
+  AND refresh_tokens.revoked_at IS NULL
+  AND refresh_tokens.expires_at > NOW()
+ORDER BY sessions.last_used_at DESC, sessions.id ASC;
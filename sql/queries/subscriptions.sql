@@ -0,0 +1,30 @@
+-- name: GetSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (user_id, status, current_period_start, current_period_end, created_at, updated_at)
+VALUES                    (     $1,     $2,                   $3,                 $4,      NOW(),      NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET status = EXCLUDED.status,
+    current_period_start = EXCLUDED.current_period_start,
+    current_period_end = EXCLUDED.current_period_end,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: UpdateSubscriptionStatus :one
+UPDATE subscriptions
+SET status = $2, updated_at = NOW()
+WHERE user_id = $1
+RETURNING *;
+
+-- name: ExpireSubscriptions :many
+UPDATE subscriptions
+SET status = 'expired', updated_at = NOW()
+WHERE status IN ('active', 'canceled')
+  AND current_period_end <= sqlc.arg('now')
+RETURNING *;
+
+-- name: CreateSubscriptionEvent :exec
+INSERT INTO subscription_events (id, user_id, event, status, current_period_end, polka_event_id, created_at)
+VALUES             (gen_random_uuid(),      $1,    $2,     $3,                 $4,             $5,      NOW());
@@ -0,0 +1,61 @@
+-- SetPendingTOTP starts 2FA setup, replacing any secret that was never
+-- verified. It does nothing once 2FA is enabled.
+-- name: SetPendingTOTP :execrows
+INSERT INTO user_totp (user_id, secret, created_at)
+VALUES                (     $1,     $2,      NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+WHERE user_totp.enabled_at IS NULL;
+
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: EnableTOTP :execrows
+UPDATE user_totp
+SET enabled_at = NOW()
+WHERE user_id = $1 AND enabled_at IS NULL;
+
+-- UseTOTPStep records the time step of a valid code, unless it, or a later
+-- one, has already been used.
+-- name: UseTOTPStep :execrows
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCodes :exec
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+SELECT gen_random_uuid(), sqlc.arg('user_id')::uuid, unnest(sqlc.arg('code_hashes')::text[]), NOW();
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CreateTwoFactorChallenge :exec
+INSERT INTO two_factor_challenges (token_hash, user_id, created_at,                   expires_at)
+VALUES                            (        $1,      $2,      NOW(), NOW() + INTERVAL '5 minutes');
+
+-- AttemptTwoFactorChallenge counts an attempt at a challenge, returning it
+-- only if it's still open.
+-- name: AttemptTwoFactorChallenge :one
+UPDATE two_factor_challenges
+SET attempts = attempts + 1
+WHERE token_hash = sqlc.arg('token_hash') AND expires_at > NOW() AND attempts < sqlc.arg('max_attempts')
+RETURNING *;
+
+-- name: DeleteTwoFactorChallenge :exec
+DELETE FROM two_factor_challenges
+WHERE token_hash = $1;
+
+-- name: DeleteExpiredTwoFactorChallenges :exec
+DELETE FROM two_factor_challenges
+WHERE expires_at <= NOW();
@@ -0,0 +1,20 @@
+-- CreateUserToken stores a token that lasts expires_in_seconds. The expiry
+-- is worked out here, like the check in UseUserToken, so both use the
+-- database's clock and time zone.
+-- name: CreateUserToken :exec
+INSERT INTO user_tokens (token_hash, user_id, purpose, email, created_at, expires_at)
+VALUES (sqlc.arg('token_hash'), sqlc.arg('user_id'), sqlc.arg('purpose'), sqlc.arg('email'), NOW(),
+        NOW() + make_interval(secs => sqlc.arg('expires_in_seconds')::float8));
+
+-- UseUserToken spends a token, returning it only if it was unused and
+-- unexpired.
+-- name: UseUserToken :one
+UPDATE user_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- DeleteUserTokens invalidates the user's unused tokens for purpose.
+-- name: DeleteUserTokens :exec
+DELETE FROM user_tokens
+WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL;
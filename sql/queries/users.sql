@@ -10,17 +10,44 @@ DELETE FROM users;
 SELECT * FROM users
 WHERE email = $1;
 
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE LOWER(handle) = LOWER($1);
+
 -- name: UpdateUser :one
 UPDATE users
 SET
   email = COALESCE(sqlc.narg('email'), email),
   hashed_password = COALESCE(sqlc.narg('hashed_password'), hashed_password),
+  handle = COALESCE(sqlc.narg('handle'), handle),
+  display_name = COALESCE(sqlc.narg('display_name'), display_name),
+  bio = COALESCE(sqlc.narg('bio'), bio),
+  -- A new email address has to be verified again.
+  email_verified_at = CASE WHEN sqlc.narg('email') IS NULL OR sqlc.narg('email') = email THEN email_verified_at END,
   updated_at = NOW()
 WHERE id = $1
-RETURNING
-  id, created_at, updated_at, email, is_chirpy_red;
+RETURNING *;
 
--- name: UpgradeUserToChirpyRed :exec
+-- name: VerifyUserEmail :one
 UPDATE users
-SET is_chirpy_red = true
-WHERE id = $1;
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+RETURNING *;
+
+-- RehashUserPassword swaps in a hash made with new parameters, unless the
+-- password has changed since old_hash was read.
+-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = sqlc.arg('new_hash')
+WHERE id = sqlc.arg('id') AND hashed_password = sqlc.arg('old_hash');
+
+-- PromoteUserToAdmin makes the user with email an admin, as long as they've
+-- verified it, so whoever signs up with the address first doesn't get in.
+-- name: PromoteUserToAdmin :execrows
+UPDATE users
+SET role = 'admin', updated_at = NOW()
+WHERE email = $1 AND email_verified_at IS NOT NULL;
@@ -0,0 +1,29 @@
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, headers, body, received_at, status)
+VALUES            (gen_random_uuid(),      $1,   $2,       NOW(), 'pending')
+RETURNING *;
+
+-- name: FinishWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = $2,
+    response_code = $3,
+    error = sqlc.narg('error'),
+    event_id = COALESCE(sqlc.narg('event_id'), event_id),
+    event = COALESCE(sqlc.narg('event'), event),
+    attempts = attempts + 1,
+    processed_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE (sqlc.narg('status')::text IS NULL OR status = sqlc.narg('status')::text)
+  AND (sqlc.narg('event')::text IS NULL OR event = sqlc.narg('event')::text)
+  AND (sqlc.narg('after_received_at')::timestamp IS NULL
+       OR (received_at, id) < (sqlc.narg('after_received_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY received_at DESC, id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,43 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN parent_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN reply_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX chirps_parent_id_idx ON chirps (parent_id, created_at, id);
+
+-- reply_count is kept by the database so concurrent replies and cascading
+-- deletes can't leave it out of step.
+-- +goose StatementBegin
+CREATE FUNCTION chirps_update_reply_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.parent_id IS NOT NULL THEN
+        UPDATE chirps SET reply_count = reply_count - 1 WHERE id = OLD.parent_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.parent_id IS NOT NULL THEN
+        UPDATE chirps SET reply_count = reply_count + 1 WHERE id = NEW.parent_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirps_reply_count_insert_delete
+AFTER INSERT OR DELETE ON chirps
+FOR EACH ROW EXECUTE FUNCTION chirps_update_reply_count();
+
+CREATE TRIGGER chirps_reply_count_update
+AFTER UPDATE OF parent_id ON chirps
+FOR EACH ROW
+WHEN (OLD.parent_id IS DISTINCT FROM NEW.parent_id)
+EXECUTE FUNCTION chirps_update_reply_count();
+
+-- +goose Down
+DROP TRIGGER chirps_reply_count_update ON chirps;
+DROP TRIGGER chirps_reply_count_insert_delete ON chirps;
+DROP FUNCTION chirps_update_reply_count();
+DROP INDEX chirps_parent_id_idx;
+ALTER TABLE chirps
+DROP COLUMN deleted_at,
+DROP COLUMN reply_count,
+DROP COLUMN parent_id;
@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE likes(user_id UUID NOT NULL,
+                   FOREIGN KEY (user_id) REFERENCES users(id)
+                   ON DELETE CASCADE,
+                   chirp_id UUID NOT NULL,
+                   FOREIGN KEY (chirp_id) REFERENCES chirps(id)
+                   ON DELETE CASCADE,
+                   created_at TIMESTAMP NOT NULL,
+                   PRIMARY KEY (user_id, chirp_id));
+
+CREATE INDEX likes_chirp_id_idx ON likes (chirp_id);
+CREATE INDEX likes_user_id_created_at_idx ON likes (user_id, created_at, chirp_id);
+
+ALTER TABLE chirps
+ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementBegin
+CREATE FUNCTION likes_update_like_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE chirps SET like_count = like_count + 1 WHERE id = NEW.chirp_id;
+    ELSE
+        UPDATE chirps SET like_count = like_count - 1 WHERE id = OLD.chirp_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER likes_like_count
+AFTER INSERT OR DELETE ON likes
+FOR EACH ROW EXECUTE FUNCTION likes_update_like_count();
+
+-- +goose Down
+DROP TRIGGER likes_like_count ON likes;
+DROP FUNCTION likes_update_like_count();
+ALTER TABLE chirps
+DROP COLUMN like_count;
+DROP TABLE likes;
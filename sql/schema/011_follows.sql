@@ -0,0 +1,43 @@
+-- +goose Up
+CREATE TABLE follows(follower_id UUID NOT NULL,
+                     FOREIGN KEY (follower_id) REFERENCES users(id)
+                     ON DELETE CASCADE,
+                     followee_id UUID NOT NULL,
+                     FOREIGN KEY (followee_id) REFERENCES users(id)
+                     ON DELETE CASCADE,
+                     created_at TIMESTAMP NOT NULL,
+                     PRIMARY KEY (follower_id, followee_id),
+                     CHECK (follower_id <> followee_id));
+
+CREATE INDEX follows_followee_id_idx ON follows (followee_id);
+
+ALTER TABLE users
+ADD COLUMN follower_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN following_count INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementBegin
+CREATE FUNCTION follows_update_counts() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET following_count = following_count + 1 WHERE id = NEW.follower_id;
+        UPDATE users SET follower_count = follower_count + 1 WHERE id = NEW.followee_id;
+    ELSE
+        UPDATE users SET following_count = following_count - 1 WHERE id = OLD.follower_id;
+        UPDATE users SET follower_count = follower_count - 1 WHERE id = OLD.followee_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER follows_counts
+AFTER INSERT OR DELETE ON follows
+FOR EACH ROW EXECUTE FUNCTION follows_update_counts();
+
+-- +goose Down
+DROP TRIGGER follows_counts ON follows;
+DROP FUNCTION follows_update_counts();
+ALTER TABLE users
+DROP COLUMN following_count,
+DROP COLUMN follower_count;
+DROP TABLE follows;
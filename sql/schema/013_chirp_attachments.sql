@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE chirp_attachments(id UUID PRIMARY KEY,
+                               chirp_id UUID NOT NULL,
+                               FOREIGN KEY (chirp_id) REFERENCES chirps(id)
+                               ON DELETE CASCADE,
+                               position INTEGER NOT NULL,
+                               content_type TEXT NOT NULL,
+                               blob_key TEXT NOT NULL,
+                               width INTEGER NOT NULL,
+                               height INTEGER NOT NULL,
+                               thumb_key TEXT NOT NULL,
+                               thumb_width INTEGER NOT NULL,
+                               thumb_height INTEGER NOT NULL,
+                               created_at TIMESTAMP NOT NULL,
+                               UNIQUE (chirp_id, position));
+
+-- +goose Down
+DROP TABLE chirp_attachments;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE chirp_tags(chirp_id UUID NOT NULL,
+                        FOREIGN KEY (chirp_id) REFERENCES chirps(id)
+                        ON DELETE CASCADE,
+                        tag TEXT NOT NULL,
+                        created_at TIMESTAMP NOT NULL,
+                        PRIMARY KEY (chirp_id, tag));
+
+CREATE INDEX chirp_tags_tag_created_at_idx ON chirp_tags (tag, created_at, chirp_id);
+CREATE INDEX chirp_tags_created_at_idx ON chirp_tags (created_at);
+
+-- +goose Down
+DROP TABLE chirp_tags;
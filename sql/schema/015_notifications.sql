@@ -0,0 +1,32 @@
+-- +goose Up
+CREATE TABLE chirp_mentions(chirp_id UUID NOT NULL,
+                            FOREIGN KEY (chirp_id) REFERENCES chirps(id)
+                            ON DELETE CASCADE,
+                            user_id UUID NOT NULL,
+                            FOREIGN KEY (user_id) REFERENCES users(id)
+                            ON DELETE CASCADE,
+                            PRIMARY KEY (chirp_id, user_id));
+
+CREATE INDEX chirp_mentions_user_id_idx ON chirp_mentions (user_id);
+
+CREATE TABLE notifications(id UUID PRIMARY KEY,
+                           user_id UUID NOT NULL,
+                           FOREIGN KEY (user_id) REFERENCES users(id)
+                           ON DELETE CASCADE,
+                           actor_id UUID NOT NULL,
+                           FOREIGN KEY (actor_id) REFERENCES users(id)
+                           ON DELETE CASCADE,
+                           kind TEXT NOT NULL
+                           CHECK (kind IN ('mention', 'reply', 'like', 'follow')),
+                           chirp_id UUID,
+                           FOREIGN KEY (chirp_id) REFERENCES chirps(id)
+                           ON DELETE CASCADE,
+                           created_at TIMESTAMP NOT NULL,
+                           read_at TIMESTAMP);
+
+CREATE INDEX notifications_user_id_created_at_idx ON notifications (user_id, created_at, id);
+CREATE INDEX notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+
+-- +goose Down
+DROP TABLE notifications;
+DROP TABLE chirp_mentions;
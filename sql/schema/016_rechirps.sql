@@ -0,0 +1,57 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN rechirp_of UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN quote_of UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN rechirp_count INTEGER NOT NULL DEFAULT 0;
+
+-- A user can rechirp a given chirp only once.
+CREATE UNIQUE INDEX chirps_user_id_rechirp_of_idx ON chirps (user_id, rechirp_of)
+WHERE rechirp_of IS NOT NULL;
+CREATE INDEX chirps_rechirp_of_idx ON chirps (rechirp_of) WHERE rechirp_of IS NOT NULL;
+CREATE INDEX chirps_quote_of_idx ON chirps (quote_of) WHERE quote_of IS NOT NULL;
+
+-- +goose StatementBegin
+CREATE FUNCTION chirps_update_rechirp_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.rechirp_of IS NOT NULL THEN
+        UPDATE chirps SET rechirp_count = rechirp_count - 1 WHERE id = OLD.rechirp_of;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.rechirp_of IS NOT NULL THEN
+        UPDATE chirps SET rechirp_count = rechirp_count + 1 WHERE id = NEW.rechirp_of;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER chirps_rechirp_count_insert_delete
+AFTER INSERT OR DELETE ON chirps
+FOR EACH ROW EXECUTE FUNCTION chirps_update_rechirp_count();
+
+CREATE TRIGGER chirps_rechirp_count_update
+AFTER UPDATE OF rechirp_of ON chirps
+FOR EACH ROW
+WHEN (OLD.rechirp_of IS DISTINCT FROM NEW.rechirp_of)
+EXECUTE FUNCTION chirps_update_rechirp_count();
+
+ALTER TABLE notifications
+DROP CONSTRAINT notifications_kind_check,
+ADD CONSTRAINT notifications_kind_check
+CHECK (kind IN ('mention', 'reply', 'like', 'follow', 'rechirp', 'quote'));
+
+-- +goose Down
+DELETE FROM notifications WHERE kind IN ('rechirp', 'quote');
+ALTER TABLE notifications
+DROP CONSTRAINT notifications_kind_check,
+ADD CONSTRAINT notifications_kind_check
+CHECK (kind IN ('mention', 'reply', 'like', 'follow'));
+DROP TRIGGER chirps_rechirp_count_update ON chirps;
+DROP TRIGGER chirps_rechirp_count_insert_delete ON chirps;
+DROP FUNCTION chirps_update_rechirp_count();
+DROP INDEX chirps_quote_of_idx;
+DROP INDEX chirps_rechirp_of_idx;
+DROP INDEX chirps_user_id_rechirp_of_idx;
+ALTER TABLE chirps
+DROP COLUMN rechirp_count,
+DROP COLUMN quote_of,
+DROP COLUMN rechirp_of;
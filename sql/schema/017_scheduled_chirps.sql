@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE scheduled_chirps(id UUID PRIMARY KEY,
+                              user_id UUID NOT NULL,
+                              FOREIGN KEY (user_id) REFERENCES users(id)
+                              ON DELETE CASCADE,
+                              body TEXT NOT NULL,
+                              parent_id UUID,
+                              FOREIGN KEY (parent_id) REFERENCES chirps(id)
+                              ON DELETE CASCADE,
+                              quote_of UUID,
+                              FOREIGN KEY (quote_of) REFERENCES chirps(id)
+                              ON DELETE CASCADE,
+                              publish_at TIMESTAMP NOT NULL,
+                              created_at TIMESTAMP NOT NULL);
+
+CREATE INDEX scheduled_chirps_publish_at_idx ON scheduled_chirps (publish_at);
+CREATE INDEX scheduled_chirps_user_id_idx ON scheduled_chirps (user_id, publish_at);
+
+-- +goose Down
+DROP TABLE scheduled_chirps;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- polka_events records every webhook event that has been applied, so a
+-- redelivered event is acknowledged without being applied again.
+CREATE TABLE polka_events(id TEXT PRIMARY KEY,
+                          event TEXT NOT NULL,
+                          received_at TIMESTAMP NOT NULL);
+
+-- +goose Down
+DROP TABLE polka_events;
@@ -0,0 +1,52 @@
+-- +goose Up
+CREATE TABLE subscriptions(user_id UUID PRIMARY KEY,
+                           FOREIGN KEY (user_id) REFERENCES users(id)
+                           ON DELETE CASCADE,
+                           plan TEXT NOT NULL DEFAULT 'red',
+                           status TEXT NOT NULL
+                           CHECK (status IN ('active', 'canceled', 'expired', 'refunded')),
+                           current_period_start TIMESTAMP NOT NULL,
+                           current_period_end TIMESTAMP NOT NULL,
+                           created_at TIMESTAMP NOT NULL,
+                           updated_at TIMESTAMP NOT NULL);
+
+CREATE INDEX subscriptions_current_period_end_idx ON subscriptions (current_period_end)
+WHERE status IN ('active', 'canceled');
+
+-- subscription_events is the history of every change to a subscription.
+CREATE TABLE subscription_events(id UUID PRIMARY KEY,
+                                 user_id UUID NOT NULL,
+                                 FOREIGN KEY (user_id) REFERENCES users(id)
+                                 ON DELETE CASCADE,
+                                 event TEXT NOT NULL,
+                                 status TEXT NOT NULL,
+                                 current_period_end TIMESTAMP NOT NULL,
+                                 polka_event_id TEXT,
+                                 created_at TIMESTAMP NOT NULL);
+
+CREATE INDEX subscription_events_user_id_idx ON subscription_events (user_id, created_at);
+
+-- Existing Chirpy Red users get a month from now, after which Polka's next
+-- renewal takes over.
+INSERT INTO subscriptions (user_id, status, current_period_start, current_period_end, created_at, updated_at)
+SELECT id, 'active', NOW(), NOW() + INTERVAL '1 month', NOW(), NOW()
+FROM users
+WHERE is_chirpy_red;
+
+INSERT INTO subscription_events (id, user_id, event, status, current_period_end, created_at)
+SELECT gen_random_uuid(), user_id, 'migrated', status, current_period_end, NOW()
+FROM subscriptions;
+
+ALTER TABLE users
+DROP COLUMN is_chirpy_red;
+
+-- +goose Down
+ALTER TABLE users
+ADD COLUMN is_chirpy_red BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE users SET is_chirpy_red = true
+WHERE id IN (SELECT user_id FROM subscriptions
+             WHERE status IN ('active', 'canceled') AND current_period_end > NOW());
+
+DROP TABLE subscription_events;
+DROP TABLE subscriptions;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- webhook_deliveries keeps every inbound webhook request, written before it
+-- is processed, so failed deliveries can be inspected and replayed.
+CREATE TABLE webhook_deliveries(id UUID PRIMARY KEY,
+                                event_id TEXT,
+                                event TEXT,
+                                headers JSONB NOT NULL,
+                                body BYTEA NOT NULL,
+                                received_at TIMESTAMP NOT NULL,
+                                status TEXT NOT NULL
+                                CHECK (status IN ('pending', 'processed', 'duplicate', 'rejected', 'failed')),
+                                response_code INTEGER,
+                                error TEXT,
+                                attempts INTEGER NOT NULL DEFAULT 0,
+                                processed_at TIMESTAMP);
+
+CREATE INDEX webhook_deliveries_received_at_idx ON webhook_deliveries (received_at, id);
+CREATE INDEX webhook_deliveries_status_idx ON webhook_deliveries (status, received_at, id);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
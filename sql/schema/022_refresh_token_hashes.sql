@@ -0,0 +1,14 @@
+-- +goose Up
+-- Only a SHA-256 hash of each refresh token is kept, so the table can't be
+-- used to hijack sessions. Existing tokens are hashed in place and keep
+-- working, since clients still present the raw token.
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+UPDATE refresh_tokens SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
+
+-- +goose Down
+-- The raw tokens can't be recovered, so everyone has to log in again.
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+-- Accounts made before verification existed are trusted as they are, rather
+-- than being restricted until they verify.
+UPDATE users SET email_verified_at = created_at;
+
+-- Single-use tokens sent by email. Only a hash is stored. email is the
+-- address the token was sent to, so a verification link stops working if
+-- the address changes.
+CREATE TABLE user_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL CHECK (purpose IN ('verify_email', 'reset_password')),
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX user_tokens_user_id_purpose_idx ON user_tokens (user_id, purpose);
+
+-- +goose Down
+DROP TABLE user_tokens;
+ALTER TABLE users
+DROP COLUMN email_verified_at;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Index the body's tsvector instead of storing it, so it isn't read back
+-- with every chirp.
+DROP INDEX chirps_search_idx;
+ALTER TABLE chirps
+DROP COLUMN search;
+
+CREATE INDEX chirps_search_idx ON chirps USING GIN (to_tsvector('english', body));
+
+-- +goose Down
+DROP INDEX chirps_search_idx;
+ALTER TABLE chirps
+ADD COLUMN search TSVECTOR NOT NULL
+    GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+
+CREATE INDEX chirps_search_idx ON chirps USING GIN (search);
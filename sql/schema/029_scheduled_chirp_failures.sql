@@ -0,0 +1,15 @@
+-- +goose Up
+-- A chirp that can't be published is retried later, and given up on after a
+-- few attempts, so it doesn't hold up the chirps due after it.
+ALTER TABLE scheduled_chirps
+ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN last_error TEXT,
+ADD COLUMN retry_at TIMESTAMP,
+ADD COLUMN failed_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE scheduled_chirps
+DROP COLUMN failed_at,
+DROP COLUMN retry_at,
+DROP COLUMN last_error,
+DROP COLUMN attempts;
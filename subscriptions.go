@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/JoStMc/Chirpy/internal/entitlements"
+	"github.com/google/uuid"
+)
+
+const (
+	subscriptionActive   = "active"
+	subscriptionCanceled = "canceled"
+	subscriptionExpired  = "expired"
+	subscriptionRefunded = "refunded"
+
+	// defaultSubscriptionPeriod is used when Polka doesn't say when a period
+	// ends.
+	defaultSubscriptionPeriod = 30 * 24 * time.Hour
+)
+
+var errSubscriptionNotFound = errors.New("Subscription not found")
+
+// userPlan is the plan a user is on right now.
+type userPlan struct {
+	Plan     entitlements.Plan
+	RenewsAt *time.Time
+} 
+
+func (p userPlan) isChirpyRed() bool {
+	return p.Plan != entitlements.Free
+} 
+
+func getUserPlan(ctx context.Context, q *database.Queries, userID uuid.UUID) (userPlan, error) {
+	sub, err := q.GetSubscription(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return userPlan{Plan: entitlements.Free}, nil
+	} 
+	if err != nil {
+		return userPlan{}, err
+	} 
+	return planFromSubscription(sub, time.Now()), nil
+} 
+
+// planFromSubscription works out the plan from the subscription itself rather
+// than trusting that the sweeper has already expired it. A canceled
+// subscription lasts until the end of the period but doesn't renew.
+func planFromSubscription(sub database.Subscription, now time.Time) userPlan {
+	if sub.Status != subscriptionActive && sub.Status != subscriptionCanceled {
+		return userPlan{Plan: entitlements.Free}
+	} 
+	if !sub.CurrentPeriodEnd.After(now) {
+		return userPlan{Plan: entitlements.Free}
+	} 
+	plan := userPlan{Plan: entitlements.Plan(sub.Plan)}
+	if sub.Status == subscriptionActive {
+		plan.RenewsAt = &sub.CurrentPeriodEnd
+	} 
+	return plan
+} 
+
+// period is the stretch of time a subscription is paid for.
+type period struct {
+	Start time.Time
+	End   time.Time
+} 
+
+// subscriptionPeriod works out the period after an upgrade or renewal. An
+// explicit period_end from Polka is stored as it is, even if it's earlier
+// than the current end, since Polka knows what was paid for. Without one, a
+// subscription that's still paid for is extended from its current end,
+// keeping its start, and anything else starts a new period now.
+func subscriptionPeriod(current *database.Subscription, event polkaWebhookRequest, now time.Time) period {
+	p := period{Start: now}
+	if current != nil && planFromSubscription(*current, now).Plan != entitlements.Free {
+		p.Start = current.CurrentPeriodStart
+		p.End = current.CurrentPeriodEnd.Add(defaultSubscriptionPeriod)
+	} else {
+		p.End = now.Add(defaultSubscriptionPeriod)
+	} 
+	if event.Data.PeriodEnd != nil {
+		p.End = event.Data.PeriodEnd.UTC()
+	} 
+	return p
+} 
+
+func upsertSubscriptionPeriod(ctx context.Context, qtx *database.Queries, userID uuid.UUID, p period) (database.Subscription, error) {
+	return qtx.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID: userID,
+		Status: subscriptionActive,
+		CurrentPeriodStart: p.Start,
+		CurrentPeriodEnd: p.End,
+	})
+} 
+
+// applyPolkaEvent updates the user's subscription for a webhook event and
+// records it in the subscription's history. Unknown events are ignored.
+func applyPolkaEvent(ctx context.Context, qtx *database.Queries, event polkaWebhookRequest) error {
+	userID := event.Data.UserID
+	now := time.Now().UTC()
+
+	var sub database.Subscription
+	var err error
+	switch event.Event {
+	case "user.upgraded":
+		if _, err := qtx.GetUserByID(ctx, userID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return errUserNotFound
+			} 
+			return err
+		} 
+		var current *database.Subscription
+		existing, err := qtx.GetSubscription(ctx, userID)
+		if err == nil {
+			current = &existing
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		} 
+		sub, err = upsertSubscriptionPeriod(ctx, qtx, userID, subscriptionPeriod(current, event, now))
+	case "subscription.renewed":
+		sub, err = qtx.GetSubscription(ctx, userID)
+		if err != nil {
+			break
+		} 
+		sub, err = upsertSubscriptionPeriod(ctx, qtx, userID, subscriptionPeriod(&sub, event, now))
+	case "user.downgraded":
+		sub, err = qtx.UpdateSubscriptionStatus(ctx, database.UpdateSubscriptionStatusParams{
+			UserID: userID,
+			Status: subscriptionCanceled,
+		})
+	case "subscription.expired":
+		sub, err = qtx.UpdateSubscriptionStatus(ctx, database.UpdateSubscriptionStatusParams{
+			UserID: userID,
+			Status: subscriptionExpired,
+		})
+	case "payment.refunded":
+		sub, err = qtx.UpdateSubscriptionStatus(ctx, database.UpdateSubscriptionStatusParams{
+			UserID: userID,
+			Status: subscriptionRefunded,
+		})
+	default:
+		return nil
+	} 
+	if errors.Is(err, sql.ErrNoRows) {
+		return errSubscriptionNotFound
+	} 
+	if err != nil {
+		return err
+	} 
+
+	return qtx.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{
+		UserID: userID,
+		Event: event.Event,
+		Status: sub.Status,
+		CurrentPeriodEnd: sub.CurrentPeriodEnd,
+		PolkaEventID: sql.NullString{String: event.ID, Valid: event.ID != ""},
+	})
+} 
+
+// expireSubscriptions downgrades subscriptions whose period has ended every
+// interval. It runs for the life of the server.
+func (cfg *apiConfig) expireSubscriptions(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		expired, err := cfg.expireDueSubscriptions(context.Background())
+		if err != nil {
+			log.Printf("Error expiring subscriptions: %v", err)
+			continue
+		} 
+		if expired > 0 {
+			log.Printf("Expired %d subscriptions", expired)
+		} 
+	} 
+} 
+
+func (cfg *apiConfig) expireDueSubscriptions(ctx context.Context) (int, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	expired, err := qtx.ExpireSubscriptions(ctx, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	} 
+	for _, sub := range expired {
+		err := qtx.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{
+			UserID: sub.UserID,
+			Event: "subscription.expired",
+			Status: sub.Status,
+			CurrentPeriodEnd: sub.CurrentPeriodEnd,
+		})
+		if err != nil {
+			return 0, err
+		} 
+	} 
+	return len(expired), tx.Commit()
+} 
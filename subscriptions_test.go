@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+)
+
+func TestSubscriptionPeriod(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	start := now.Add(-20 * 24 * time.Hour)
+	end := now.Add(10 * 24 * time.Hour)
+	active := &database.Subscription{Plan: "red", Status: subscriptionActive, CurrentPeriodStart: start, CurrentPeriodEnd: end}
+	lapsed := &database.Subscription{Plan: "red", Status: subscriptionActive, CurrentPeriodStart: start.Add(-30 * 24 * time.Hour), CurrentPeriodEnd: start}
+	refunded := &database.Subscription{Plan: "red", Status: subscriptionRefunded, CurrentPeriodStart: start, CurrentPeriodEnd: end}
+	explicit := now.Add(5 * 24 * time.Hour)
+
+	cases := []struct {
+		name      string
+		current   *database.Subscription
+		periodEnd *time.Time
+		want      period
+	}{
+		{"new subscription", nil, nil, period{now, now.Add(defaultSubscriptionPeriod)}},
+		{"new subscription with period_end", nil, &explicit, period{now, explicit}},
+		{"early renewal", active, nil, period{start, end.Add(defaultSubscriptionPeriod)}},
+		// Polka's date is kept even when it's before the current end.
+		{"early renewal with period_end", active, &explicit, period{start, explicit}},
+		{"renewal after lapsing", lapsed, nil, period{now, now.Add(defaultSubscriptionPeriod)}},
+		{"renewal after refund", refunded, nil, period{now, now.Add(defaultSubscriptionPeriod)}},
+	}
+	for _, c := range cases {
+		var event polkaWebhookRequest
+		event.Data.PeriodEnd = c.periodEnd
+		if got := subscriptionPeriod(c.current, event, now); got != c.want {
+			t.Errorf("%s: got %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+	defaultTrendingLimit  = 10
+	maxTrendingLimit      = 50
+)
+
+// A hashtag starts a word and runs until the first character that can't be
+// part of one, so "#go," and "(#go)" both tag "go" but "a#b" tags nothing.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#])#([\p{L}\p{N}_]{1,50})`)
+
+// extractHashtags returns the distinct tags in a chirp body, lowercased, in
+// the order they first appear.
+func extractHashtags(body string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, match := range hashtagPattern.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(match[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		} 
+	} 
+	return tags
+} 
+
+func (cfg *apiConfig) handlerGetTagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid tag")
+		return
+	} 
+	p, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	} 
+
+	chirps, err := cfg.dbQueries.ListChirpsByTag(r.Context(), database.ListChirpsByTagParams{
+		Tag: tag,
+		AfterCreatedAt: p.afterCreatedAt(),
+		AfterID: p.afterID(),
+		Limit: p.queryLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving chirps: %v", err))
+		return
+	} 
+
+	n := setNextLink(w, r, p, len(chirps), func(i int) cursor {
+		return cursor{CreatedAt: chirps[i].CreatedAt, ID: chirps[i].ID}
+	})
+	apiChirps := make([]Chirp, n)
+	for i, c := range chirps[:n] {
+		apiChirps[i] = chirpFromDB(c)
+	} 
+	if err := cfg.populateChirps(r, apiChirps); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving chirps: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, apiChirps)
+} 
+
+type trendingTag struct {
+	Tag   string  `json:"tag"`
+	Uses  int64   `json:"uses"`
+	Score float64 `json:"score"`
+} 
+
+// handlerTrendingTags ranks the tags used within the window. Each use counts
+// for less the older it is, halving every quarter of the window, so a burst of
+// recent use outranks steady use from a day ago.
+func (cfg *apiConfig) handlerTrendingTags(w http.ResponseWriter, r *http.Request) {
+	window := defaultTrendingWindow
+	if windowString := r.URL.Query().Get("window"); windowString != "" {
+		d, err := time.ParseDuration(windowString)
+		if err != nil || d <= 0 || d > maxTrendingWindow {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("window must be a duration up to %s", maxTrendingWindow))
+			return
+		} 
+		window = d
+	} 
+	limit := defaultTrendingLimit
+	if limitString := r.URL.Query().Get("limit"); limitString != "" {
+		l, err := strconv.Atoi(limitString)
+		if err != nil || l < 1 || l > maxTrendingLimit {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxTrendingLimit))
+			return
+		} 
+		limit = l
+	} 
+
+	rows, err := cfg.dbQueries.GetTrendingTags(r.Context(), database.GetTrendingTagsParams{
+		HalfLifeSeconds: (window / 4).Seconds(),
+		WindowSeconds: window.Seconds(),
+		Limit: int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving trending tags: %v", err))
+		return
+	} 
+
+	tags := make([]trendingTag, len(rows))
+	for i, row := range rows {
+		tags[i] = trendingTag{Tag: row.Tag, Uses: row.Uses, Score: row.Score}
+	} 
+	respondWithJSON(w, http.StatusOK, tags)
+} 
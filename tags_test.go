@@ -0,0 +1,31 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	cases := []struct {
+		body string
+		want []string
+	}{
+		{"", nil},
+		{"no tags here", nil},
+		{"#go", []string{"go"}},
+		{"learning #Go today", []string{"go"}},
+		{"#go, (#rust) and #go again", []string{"go", "rust"}},
+		{"#GO #go #Go", []string{"go"}},
+		// Tags have to start a word.
+		{"a#b", nil},
+		{"&#39; ##double", nil},
+		{"#snake_case #2024", []string{"snake_case", "2024"}},
+		{"#café #über", []string{"café", "über"}},
+		{"#", nil},
+	}
+	for _, c := range cases {
+		if got := extractHashtags(c.body); !slices.Equal(got, c.want) {
+			t.Errorf("extractHashtags(%q) = %q, want %q", c.body, got, c.want)
+		}
+	}
+}
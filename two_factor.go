@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/auth"
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer = "Chirpy"
+	recoveryCodeCount = 10
+	// maxTwoFactorAttempts is how many codes can be tried against one login
+	// before the password has to be entered again.
+	maxTwoFactorAttempts = 5
+)
+
+// twoFactorEnabled reports whether the user has verified an authenticator,
+// so logging in needs a code.
+func (cfg *apiConfig) twoFactorEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	totp, err := cfg.dbQueries.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} 
+	if err != nil {
+		return false, err
+	} 
+	return totp.EnabledAt.Valid, nil
+} 
+
+type loginChallengeResponse struct {
+	TwoFactorRequired bool `json:"two_factor_required"`
+	ChallengeToken string `json:"challenge_token"`
+} 
+
+// respondWithTwoFactorChallenge is handlerLogin for users with 2FA. Instead
+// of tokens, they get a challenge to exchange, along with a code, at
+// handlerLoginTwoFactor.
+func (cfg *apiConfig) respondWithTwoFactorChallenge(ctx context.Context, w http.ResponseWriter, userID uuid.UUID) {
+	if err := cfg.dbQueries.DeleteExpiredTwoFactorChallenges(ctx); err != nil {
+		log.Printf("Error deleting expired 2FA challenges: %v", err)
+	} 
+
+	challenge := auth.MakeRefreshToken()
+	err := cfg.dbQueries.CreateTwoFactorChallenge(ctx, database.CreateTwoFactorChallengeParams{
+		TokenHash: auth.HashToken(challenge),
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error creating challenge: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, loginChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken: challenge,
+	})
+} 
+
+// secondFactor is a code from the user's authenticator or one of their
+// recovery codes.
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+} 
+
+// checkSecondFactor verifies and uses up the code or recovery code. A code
+// only works once, and only while 2FA is enabled.
+func checkSecondFactor(ctx context.Context, q *database.Queries, userID uuid.UUID, factor secondFactor) (bool, error) {
+	if factor.RecoveryCode != "" {
+		used, err := q.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID: userID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(factor.RecoveryCode)),
+		})
+		return used > 0, err
+	} 
+
+	totp, err := q.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} 
+	if err != nil {
+		return false, err
+	} 
+	if !totp.EnabledAt.Valid {
+		return false, nil
+	} 
+	return useTOTPCode(ctx, q, totp, factor.Code)
+} 
+
+// useTOTPCode checks code against the user's secret, recording its time step
+// so it can't be replayed.
+func useTOTPCode(ctx context.Context, q *database.Queries, totp database.UserTotp, code string) (bool, error) {
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	} 
+	used, err := q.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		UserID: totp.UserID,
+		LastUsedStep: step,
+	})
+	return used > 0, err
+} 
+
+type loginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	secondFactor
+} 
+
+// handlerLoginTwoFactor finishes logging in a user with 2FA.
+func (cfg *apiConfig) handlerLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	params, err := decodeJSON[loginTwoFactorRequest](r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
+		return
+	} 
+	ctx := r.Context()
+
+	// Each try counts against the challenge, so codes can't be guessed.
+	challengeHash := auth.HashToken(params.ChallengeToken)
+	challenge, err := cfg.dbQueries.AttemptTwoFactorChallenge(ctx, database.AttemptTwoFactorChallengeParams{
+		TokenHash: challengeHash,
+		MaxAttempts: maxTwoFactorAttempts,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge, log in again")
+		return
+	} 
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking challenge: %v", err))
+		return
+	} 
+
+	// Wrong codes count as failed logins too, so guessing them is throttled
+	// the same way as guessing passwords.
+	user, err := cfg.dbQueries.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving user: %v", err))
+		return
+	} 
+	ip := clientInfoFromRequest(r).IP
+	if wait := cfg.loginThrottle.wait(user.Email, ip); wait > 0 {
+		respondWithLoginThrottled(w, wait)
+		return
+	} 
+
+	ok, err := checkSecondFactor(ctx, cfg.dbQueries, challenge.UserID, params.secondFactor)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking code: %v", err))
+		return
+	} 
+	if !ok {
+		cfg.loginThrottle.fail(user.Email, ip)
+		respondWithError(w, http.StatusUnauthorized, "Incorrect code")
+		return
+	} 
+
+	if err := cfg.dbQueries.DeleteTwoFactorChallenge(ctx, challengeHash); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error finishing challenge: %v", err))
+		return
+	} 
+	cfg.respondWithLogin(w, r, user)
+} 
+
+type twoFactorSetupResponse struct {
+	Secret string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+} 
+
+// handlerSetupTwoFactor makes a new authenticator secret for the user. 2FA
+// isn't enabled until a code from it is verified.
+func (cfg *apiConfig) handlerSetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+	ctx := r.Context()
+	user, err := cfg.dbQueries.GetUserByID(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	} 
+
+	secret := auth.GenerateTOTPSecret()
+	set, err := cfg.dbQueries.SetPendingTOTP(ctx, database.SetPendingTOTPParams{
+		UserID: userID,
+		Secret: secret,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error setting up 2FA: %v", err))
+		return
+	} 
+	if set == 0 {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, twoFactorSetupResponse{
+		Secret: secret,
+		OTPAuthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+} 
+
+type verifyTwoFactorRequest struct {
+	Code string `json:"code"`
+} 
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+} 
+
+// handlerVerifyTwoFactor enables 2FA once the user proves their authenticator
+// works, and gives them recovery codes in case they lose it.
+func (cfg *apiConfig) handlerVerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+	params, err := decodeJSON[verifyTwoFactorRequest](r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
+		return
+	} 
+
+	ctx := r.Context()
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error starting transaction: %v", err))
+		return
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	totp, err := qtx.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "Two-factor authentication hasn't been set up")
+		return
+	} 
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving 2FA: %v", err))
+		return
+	} 
+	if totp.EnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	} 
+	ok, err := useTOTPCode(ctx, qtx, totp, params.Code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking code: %v", err))
+		return
+	} 
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Incorrect code")
+		return
+	} 
+
+	enabled, err := qtx.EnableTOTP(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error enabling 2FA: %v", err))
+		return
+	} 
+	if enabled == 0 {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	} 
+	codes := auth.MakeRecoveryCodes(recoveryCodeCount)
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashToken(auth.NormalizeRecoveryCode(code))
+	} 
+	if err := qtx.DeleteRecoveryCodes(ctx, userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error creating recovery codes: %v", err))
+		return
+	} 
+	err = qtx.CreateRecoveryCodes(ctx, database.CreateRecoveryCodesParams{
+		UserID: userID,
+		CodeHashes: hashes,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error creating recovery codes: %v", err))
+		return
+	} 
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error enabling 2FA: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+} 
+
+// handlerDisableTwoFactor turns 2FA off, given a current code or a recovery
+// code.
+func (cfg *apiConfig) handlerDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.authenticatedUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
+		return
+	} 
+	params, err := decodeJSON[secondFactor](r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
+		return
+	} 
+
+	ctx := r.Context()
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error starting transaction: %v", err))
+		return
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	ok, err := checkSecondFactor(ctx, qtx, userID, params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking code: %v", err))
+		return
+	} 
+	if !ok {
+		respondWithError(w, http.StatusForbidden, "Incorrect code")
+		return
+	} 
+	if err := qtx.DeleteUserTOTP(ctx, userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error disabling 2FA: %v", err))
+		return
+	} 
+	if err := qtx.DeleteRecoveryCodes(ctx, userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error disabling 2FA: %v", err))
+		return
+	} 
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error disabling 2FA: %v", err))
+		return
+	} 
+	w.WriteHeader(http.StatusNoContent)
+} 
@@ -2,23 +2,56 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/JoStMc/Chirpy/internal/auth"
 	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/JoStMc/Chirpy/internal/entitlements"
 	"github.com/google/uuid"
 )
 
-type createUserResponse struct {
-	ID        	uuid.UUID `json:"id"`
-	CreatedAt 	time.Time `json:"created_at"`
-	UpdatedAt 	time.Time `json:"updated_at"`
-	Email     	string    `json:"email"`
-	IsChirpyRed bool	  `json:"is_chirpy_red"`
+// User is the account as its owner sees it. It is returned by the endpoints
+// that create, log in to or update an account.
+type User struct {
+	ID        	   uuid.UUID `json:"id"`
+	CreatedAt 	   time.Time `json:"created_at"`
+	UpdatedAt 	   time.Time `json:"updated_at"`
+	Email     	   string    `json:"email"`
+	EmailVerified  bool      `json:"email_verified"`
+	Role           string    `json:"role"`
+	IsChirpyRed    bool	     `json:"is_chirpy_red"`
+	Plan           string    `json:"plan"`
+	RenewsAt       *time.Time `json:"renews_at"`
+	FollowerCount  int32     `json:"follower_count"`
+	FollowingCount int32     `json:"following_count"`
+	Handle         *string   `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
 }
 
+func userFromDB(u database.User, plan userPlan) User {
+	return User{
+		ID: u.ID,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		Email: u.Email,
+		EmailVerified: u.EmailVerifiedAt.Valid,
+		Role: u.Role,
+		IsChirpyRed: plan.isChirpyRed(),
+		Plan: string(plan.Plan),
+		RenewsAt: plan.RenewsAt,
+		FollowerCount: u.FollowerCount,
+		FollowingCount: u.FollowingCount,
+		Handle: nullStringPtr(u.Handle),
+		DisplayName: u.DisplayName,
+		Bio: u.Bio,
+	} 
+} 
+
 type createUserRequest struct {
 	Email string `json:"email"`
 	Password string `json:"password"`
@@ -36,7 +69,11 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	} 
 
-	hashedPass, err := auth.HashPassword(params.Password)
+	if !cfg.checkNewPassword(w, params.Password) {
+		return
+	} 
+
+	hashedPass, err := auth.HashPassword(params.Password, cfg.passwordParams)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error hashing password: %v", err))
 		return
@@ -52,23 +89,15 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	} 
 
-	response := createUserResponse{
-	    ID: res.ID,
-		CreatedAt: res.CreatedAt,
-		UpdatedAt: res.UpdatedAt,
-		IsChirpyRed: res.IsChirpyRed,
-		Email: res.Email,
+	if err := cfg.sendUserToken(r.Context(), res.ID, res.Email, tokenVerifyEmail); err != nil {
+		log.Printf("Error sending verification email to user %s: %v", res.ID, err)
 	} 
 
-	respondWithJSON(w, http.StatusCreated, response)
+	respondWithJSON(w, http.StatusCreated, userFromDB(res, userPlan{Plan: entitlements.Free}))
 } 
 
 type loginResponse struct {
-	ID        	 uuid.UUID `json:"id"`
-	CreatedAt 	 time.Time `json:"created_at"`
-	UpdatedAt 	 time.Time `json:"updated_at"`
-	Email     	 string    `json:"email"`
-	IsChirpyRed  bool	   `json:"is_chirpy_red"`
+	User
 	Token     	 string    `json:"token"`
 	RefreshToken string	   `json:"refresh_token"`
 }
@@ -85,72 +114,109 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	} 
 	ctx := r.Context()
+	ip := clientInfoFromRequest(r).IP
+	if wait := cfg.loginThrottle.wait(params.Email, ip); wait > 0 {
+		respondWithLoginThrottled(w, wait)
+		return
+	} 
 
 	user, err := cfg.dbQueries.GetUser(ctx, params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		auth.CheckDummyPassword(params.Password, cfg.passwordParams)
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving user: %v", err))
+		return
+	} 
 	passwordMatches, _ := auth.CheckPasswordHash(params.Password, user.HashedPassword)
 	if err != nil || !passwordMatches{
+		cfg.loginThrottle.fail(params.Email, ip)
 	    respondWithError(w, http.StatusUnauthorized, "Incorrect email or password")
 		return
 	} 
+	cfg.rehashPassword(ctx, user, params.Password)
+	if cfg.blocksUnverified(user.EmailVerifiedAt.Valid) {
+		respondWithError(w, http.StatusForbidden, "Email address not verified")
+		return
+	} 
 
-	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, 3600 * time.Second)
+	twoFactor, err := cfg.twoFactorEnabled(ctx, user.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to create token: %v", err))
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking 2FA: %v", err))
+		return
+	} 
+	if twoFactor {
+		cfg.respondWithTwoFactorChallenge(ctx, w, user.ID)
 		return
 	} 
+	cfg.respondWithLogin(w, r, user)
+} 
 
-	refreshToken := auth.MakeRefreshToken()
-	_, err = cfg.dbQueries.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
-		Token: refreshToken,
-		UserID: user.ID,
-	})
+// respondWithLogin starts a session for a user who has proven who they are,
+// responding with the user and their tokens. Only then are the account's
+// failed logins forgotten, so a right password alone doesn't reset them for
+// a user with 2FA.
+func (cfg *apiConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, user database.User) {
+	ctx := r.Context()
+	plan, err := getUserPlan(ctx, cfg.dbQueries, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving plan: %v", err))
+		return
+	} 
+
+	sessionID, refreshToken, err := cfg.startSession(ctx, user.ID, clientInfoFromRequest(r))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("error creating refresh token: %v", err))
 		return
 	} 
 
+	token, err := auth.MakeJWT(user.ID, sessionID, cfg.scopesFor(user.EmailVerifiedAt.Valid), cfg.jwtKeys, 3600 * time.Second)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Unable to create token: %v", err))
+		return
+	} 
+
+	cfg.loginThrottle.succeed(user.Email)
 	response := loginResponse{
-	    ID: user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		IsChirpyRed: user.IsChirpyRed,
-		Email: user.Email,
+		User: userFromDB(user, plan),
 		Token: token,
 		RefreshToken: refreshToken,
 	} 
 	respondWithJSON(w, http.StatusOK, response)
 } 
 
-type updateUserResponse struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	IsChirpyRed bool	  `json:"is_chirpy_red"`
-	Email       string    `json:"email"`
-} 
-
 type updateUserRequest struct {
-	Email 	 *string `json:"email"`
-	Password *string `json:"password"`
+	Email 	 	*string `json:"email"`
+	Password 	*string `json:"password"`
+	Handle   	*string `json:"handle"`
+	DisplayName *string `json:"display_name"`
+	Bio      	*string `json:"bio"`
+	// RevokeOtherSessions logs out every other session when the password
+	// is changed.
+	RevokeOtherSessions bool `json:"revoke_other_sessions"`
 } 
 
 func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	caller, err := cfg.authenticate(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Error getting user token: %v", err))
+		respondWithError(w, http.StatusUnauthorized, fmt.Sprint(err))
 		return
 	} 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-	    respondWithError(w, http.StatusUnauthorized, "Invalid token")
+	if !caller.hasScope(scopeProfileWrite) {
+		respondWithError(w, http.StatusForbidden, fmt.Sprintf("%v %s", errInsufficientScope, scopeProfileWrite))
 		return
 	} 
+	userID := caller.UserID
 
 	params, err := decodeJSON[updateUserRequest](r)
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error decoding parameters: %v", err))
 		return
 	} 
+	// Whoever holds a key shouldn't be able to take over the account.
+	if caller.APIKey && (params.Email != nil || params.Password != nil) {
+		respondWithError(w, http.StatusForbidden, "Email and password can't be changed with an API key")
+		return
+	} 
 	ctx := r.Context()
 
 	emailArg := sql.NullString{Valid: false}
@@ -161,35 +227,87 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 	    emailArg.Valid = true
 	} 
 	if params.Password != nil {
+		if !cfg.checkNewPassword(w, *params.Password) {
+			return
+		} 
 		hashedPassword.Valid = true
-		hashedPassword.String, err = auth.HashPassword(*params.Password)
+		hashedPassword.String, err = auth.HashPassword(*params.Password, cfg.passwordParams)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error hashing password: %v", err))
 			return
 		} 
 	} 
 
-	if !hashedPassword.Valid && !emailArg.Valid {
-	    respondWithError(w, http.StatusBadRequest, "Email and password not provided")
+	if err := validateProfile(params); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	} 
+	handleArg := nullString(params.Handle)
+	displayNameArg := nullString(params.DisplayName)
+	bioArg := nullString(params.Bio)
+
+	if !hashedPassword.Valid && !emailArg.Valid && !handleArg.Valid && !displayNameArg.Valid && !bioArg.Valid {
+	    respondWithError(w, http.StatusBadRequest, "Nothing to update")
 		return
 	} 
 
-	updatedUser, err := cfg.dbQueries.UpdateUser(ctx, database.UpdateUserParams{
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error starting transaction: %v", err))
+		return
+	} 
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	updatedUser, err := qtx.UpdateUser(ctx, database.UpdateUserParams{
 		ID: userID,
 		Email: emailArg,
 		HashedPassword: hashedPassword,
+		Handle: handleArg,
+		DisplayName: displayNameArg,
+		Bio: bioArg,
 	})
 	if err != nil {
+		if isUniqueViolation(err, "users_handle_idx") {
+			respondWithError(w, http.StatusConflict, "Handle already taken")
+			return
+		} 
+		if isUniqueViolation(err, "users_email_key") {
+			respondWithError(w, http.StatusConflict, "Email already in use")
+			return
+		} 
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error updating user: %v", err))
 		return
 	} 
 
-	response := updateUserResponse{
-		ID: userID,
-		Email: updatedUser.Email,
-		IsChirpyRed: updatedUser.IsChirpyRed,
-		CreatedAt: updatedUser.CreatedAt,
-		UpdatedAt: updatedUser.UpdatedAt,
-	}
-	respondWithJSON(w, http.StatusOK, response)
+	if hashedPassword.Valid && params.RevokeOtherSessions {
+		// Tokens from before sessions were tracked have no session, so
+		// every session is revoked.
+		_, err = qtx.RevokeOtherUserRefreshTokens(ctx, database.RevokeOtherUserRefreshTokensParams{
+			UserID: userID,
+			KeepFamilyID: caller.SessionID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error revoking sessions: %v", err))
+			return
+		} 
+	} 
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error updating user: %v", err))
+		return
+	} 
+
+	// A new email address has to be verified again.
+	if emailArg.Valid && !updatedUser.EmailVerifiedAt.Valid {
+		if err := cfg.sendUserToken(ctx, userID, updatedUser.Email, tokenVerifyEmail); err != nil {
+			log.Printf("Error sending verification email to user %s: %v", userID, err)
+		} 
+	} 
+
+	plan, err := getUserPlan(ctx, cfg.dbQueries, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving plan: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, userFromDB(updatedUser, plan))
 }
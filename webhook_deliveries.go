@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/JoStMc/Chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	deliveryProcessed = "processed"
+	deliveryDuplicate = "duplicate"
+	// deliveryRejected is for requests that failed authentication or couldn't
+	// be parsed. They are never replayed, and those that failed
+	// authentication are logged without their body.
+	deliveryRejected = "rejected"
+	// deliveryFailed is for authentic events that couldn't be applied. They
+	// can be replayed once the cause is fixed.
+	deliveryFailed = "failed"
+)
+
+// deliveryResult is the outcome of processing a webhook delivery, along with
+// the response Polka gets.
+type deliveryResult struct {
+	Status  string
+	Code    int
+	Err     error
+	EventID string
+	Event   string
+} 
+
+// WebhookDelivery is a logged webhook request as admins see it.
+type WebhookDelivery struct {
+	ID           uuid.UUID       `json:"id"`
+	EventID      *string         `json:"event_id"`
+	Event        *string         `json:"event"`
+	Headers      json.RawMessage `json:"headers"`
+	Body         string          `json:"body"`
+	ReceivedAt   time.Time       `json:"received_at"`
+	Status       string          `json:"status"`
+	ResponseCode *int32          `json:"response_code"`
+	Error        *string         `json:"error"`
+	Attempts     int32           `json:"attempts"`
+	ProcessedAt  *time.Time      `json:"processed_at"`
+} 
+
+func webhookDeliveryFromDB(d database.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID: d.ID,
+		EventID: nullStringPtr(d.EventID),
+		Event: nullStringPtr(d.Event),
+		Headers: d.Headers,
+		Body: string(d.Body),
+		ReceivedAt: d.ReceivedAt,
+		Status: d.Status,
+		Error: nullStringPtr(d.Error),
+		Attempts: d.Attempts,
+	} 
+	if d.ResponseCode.Valid {
+		delivery.ResponseCode = &d.ResponseCode.Int32
+	} 
+	if d.ProcessedAt.Valid {
+		delivery.ProcessedAt = &d.ProcessedAt.Time
+	} 
+	return delivery
+} 
+
+// logWebhookDelivery stores a delivery before it's processed. Credentials
+// are left out of the stored headers. Authentic deliveries are stored with
+// their body; rejected ones are stored without it by logRejectedWebhook.
+func (cfg *apiConfig) logWebhookDelivery(ctx context.Context, header http.Header, body []byte) (database.WebhookDelivery, error) {
+	stored := header.Clone()
+	stored.Del("Authorization")
+	headers, err := json.Marshal(stored)
+	if err != nil {
+		return database.WebhookDelivery{}, err
+	} 
+	return cfg.dbQueries.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+		Headers: headers,
+		Body: body,
+	})
+} 
+
+// finishWebhookDelivery records how a delivery was processed. Failing to do
+// so is only logged, since the event itself has already been handled.
+func (cfg *apiConfig) finishWebhookDelivery(ctx context.Context, id uuid.UUID, result deliveryResult) (database.WebhookDelivery, error) {
+	arg := database.FinishWebhookDeliveryParams{
+		ID: id,
+		Status: result.Status,
+		ResponseCode: sql.NullInt32{Int32: int32(result.Code), Valid: true},
+		EventID: sql.NullString{String: result.EventID, Valid: result.EventID != ""},
+		Event: sql.NullString{String: result.Event, Valid: result.Event != ""},
+	} 
+	if result.Err != nil {
+		arg.Error = sql.NullString{String: result.Err.Error(), Valid: true}
+	} 
+	delivery, err := cfg.dbQueries.FinishWebhookDelivery(ctx, arg)
+	if err != nil {
+		log.Printf("Error recording outcome of webhook delivery %s: %v", id, err)
+	} 
+	return delivery, err
+} 
+
+// handlerGetWebhookDeliveries lists deliveries, newest first. It takes
+// optional "status" and "event" filters along with the usual paging.
+func (cfg *apiConfig) handlerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	p, err := parsePage(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	} 
+	query := r.URL.Query()
+	status := query.Get("status")
+	event := query.Get("event")
+
+	deliveries, err := cfg.dbQueries.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+		Status: sql.NullString{String: status, Valid: status != ""},
+		Event: sql.NullString{String: event, Valid: event != ""},
+		AfterReceivedAt: p.afterCreatedAt(),
+		AfterID: p.afterID(),
+		Limit: p.queryLimit(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving deliveries: %v", err))
+		return
+	} 
+
+	n := setNextLink(w, r, p, len(deliveries), func(i int) cursor {
+		return cursor{CreatedAt: deliveries[i].ReceivedAt, ID: deliveries[i].ID}
+	})
+	response := make([]WebhookDelivery, n)
+	for i, d := range deliveries[:n] {
+		response[i] = webhookDeliveryFromDB(d)
+	} 
+	respondWithJSON(w, http.StatusOK, response)
+} 
+
+// handlerReplayWebhookDelivery runs a failed delivery again. Its signature was
+// checked when it first arrived, so it isn't checked again.
+func (cfg *apiConfig) handlerReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprint(err))
+		return
+	} 
+
+	ctx := r.Context()
+	delivery, err := cfg.dbQueries.GetWebhookDelivery(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "Delivery not found")
+			return
+		} 
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error retrieving delivery: %v", err))
+		return
+	} 
+	if delivery.Status != deliveryFailed {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Only failed deliveries can be replayed, this one is %s", delivery.Status))
+		return
+	} 
+
+	// A failed delivery already got past the event id check when it arrived.
+	result := cfg.applyPolkaDelivery(ctx, delivery.Body, false)
+	delivery, err = cfg.finishWebhookDelivery(ctx, delivery.ID, result)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error recording replay: %v", err))
+		return
+	} 
+	respondWithJSON(w, http.StatusOK, webhookDeliveryFromDB(delivery))
+} 